@@ -0,0 +1,97 @@
+package convay
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The characters of the plaintext (.cells) format.  The standard
+// format has only '.' and 'O' (or '*'), the young cells are our
+// extension.  When writing, 'O' are the old cells.
+const (
+	cellsEmpty = '.'
+	cellsOld   = 'O'
+	cellsLive  = '*'
+	cellsYoung = 'o'
+)
+
+// ReadCells reads the pattern in the plaintext (.cells) format.
+// The live cells 'O' and '*' get the value live, 'o' are young.
+func ReadCells(r io.Reader, live uint64) (*Pattern, error) {
+	var rows [][]uint64
+	name := ""
+	scanner := bufio.NewScanner(r)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if strings.HasPrefix(line, "!") {
+			if strings.HasPrefix(line, "!Name:") {
+				name = strings.TrimSpace(line[len("!Name:"):])
+			}
+			continue
+		}
+		row := make([]uint64, len(line))
+		for i := 0; i < len(line); i++ {
+			switch line[i] {
+			case cellsEmpty:
+				row[i] = Empty
+			case cellsOld, cellsLive:
+				row[i] = live
+			case cellsYoung:
+				row[i] = Young
+			default:
+				return nil, fmt.Errorf("line %d: invalid cell %q", lineno, line[i])
+			}
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	p := newPatternFromRows(rows, 0, 0)
+	p.Name = name
+	return p, nil
+}
+
+// WriteCells writes the whole grid in the plaintext (.cells) format.
+func (g *Grid) WriteCells(w io.Writer, name string) error {
+	return writeCells(w, name, g, 0, 0, g.cellsPerRow, len(g.area))
+}
+
+// WriteCells writes the bounding box of the live cells in the plaintext
+// (.cells) format, with the coordinates of its top-left corner.
+func (s *Sparse) WriteCells(w io.Writer, name string) error {
+	x0, y0, x1, y1 := s.Bounds()
+	return writeCells(w, name, s, x0, y0, x1-x0, y1-y0)
+}
+
+// writeCells writes the nx*ny cells of the universe starting from (x0,y0).
+func writeCells(w io.Writer, name string, u Universe, x0, y0, nx, ny int) error {
+	bw := bufio.NewWriter(w)
+	if name != "" {
+		fmt.Fprintf(bw, "!Name: %s\n", name)
+	}
+	fmt.Fprintf(bw, "!Generation: %d\n", u.Iterations())
+	if x0 != 0 || y0 != 0 {
+		fmt.Fprintf(bw, "!Origin: %d,%d\n", x0, y0)
+	}
+	line := make([]byte, nx+1)
+	line[nx] = '\n'
+	for y := y0; y < y0+ny; y++ {
+		for x := 0; x < nx; x++ {
+			switch u.Get(x0+x, y) {
+			case Young:
+				line[x] = cellsYoung
+			case Old:
+				line[x] = cellsOld
+			default:
+				line[x] = cellsEmpty
+			}
+		}
+		if _, err := bw.Write(line); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
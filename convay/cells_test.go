@@ -0,0 +1,64 @@
+package convay
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteCells(t *testing.T) {
+	g := NewGrid(5, 3)
+	g.SetDots(0, 0, "12")
+	g.SetDots(2, 3, "21")
+	var buf bytes.Buffer
+	if err := g.WriteCells(&buf, "test"); err != nil {
+		t.Fatal(err)
+	}
+	want := "!Name: test\n!Generation: 0\noO...\n.....\n...Oo\n"
+	if buf.String() != want {
+		t.Errorf("invalid output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestReadCells(t *testing.T) {
+	text := "!Name: mixed\n!comment\n.O\n*o.\n\nO\n"
+	p, err := ReadCells(strings.NewReader(text), Old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "mixed" {
+		t.Errorf("invalid name %q", p.Name)
+	}
+	ExpectInt(t, "p.Width", p.Width, 3)
+	ExpectInt(t, "p.Height", p.Height, 4)
+	ExpectUint64(t, "(1,0)", p.Get(1, 0), Old)
+	ExpectUint64(t, "(0,1)", p.Get(0, 1), Old)
+	ExpectUint64(t, "(1,1)", p.Get(1, 1), Young)
+	ExpectUint64(t, "(2,1)", p.Get(2, 1), Empty)
+	ExpectUint64(t, "(0,3)", p.Get(0, 3), Old)
+
+	p, err = ReadCells(strings.NewReader("OO\n"), Young)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ExpectUint64(t, "(0,0)", p.Get(0, 0), Young)
+
+	if _, err = ReadCells(strings.NewReader(".O\n.x\n"), Old); err == nil {
+		t.Error("invalid cell is accepted")
+	}
+}
+
+func TestCellsRoundTrip(t *testing.T) {
+	g := randomGrid(21, 7, 3)
+	var buf bytes.Buffer
+	if err := g.WriteCells(&buf, ""); err != nil {
+		t.Fatal(err)
+	}
+	p, err := ReadCells(&buf, Old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewGrid(21, 7)
+	h.Place(p, 0, 0)
+	sameGrid(t, "round trip", h, g)
+}
@@ -0,0 +1,124 @@
+package convay
+
+import (
+	"fmt"
+)
+
+// Cycle detects the repeating generations of the universe by their
+// hashes: the extinction, the still lifes and the oscillators with the
+// period up to the window.
+type Cycle struct {
+	Period  int    // the period of the cycle, 0 if not found yet
+	Start   uint64 // the first generation of the cycle
+	Extinct bool   // all cells are dead
+	window  int
+	seen    map[uint64]uint64 // the hash -> the generation
+	ring    []uint64          // the hashes of the last generations
+	next    int               // the index of the oldest hash in the ring
+}
+
+func NewCycle(window int) *Cycle {
+	c := new(Cycle)
+	c.window = window
+	c.Reset()
+	return c
+}
+
+// Reset forgets all generations, e.g. after the cells are edited.
+func (c *Cycle) Reset() {
+	c.Period = 0
+	c.Start = 0
+	c.Extinct = false
+	c.seen = make(map[uint64]uint64, c.window)
+	c.ring = c.ring[:0]
+	c.next = 0
+}
+
+// Observe records the current generation of the universe with its census
+// s, it must be called for every generation.  It tells if the cycle is
+// found.
+func (c *Cycle) Observe(u Universe, s Sample) bool {
+	if c.Period != 0 {
+		return true
+	}
+	gen := s.Generation
+	if s.Total() == 0 {
+		c.Period = 1
+		c.Start = gen
+		c.Extinct = true
+		return true
+	}
+	h := u.Hash()
+	if first, ok := c.seen[h]; ok {
+		c.Period = int(gen - first)
+		c.Start = first
+		return true
+	}
+	if len(c.ring) < c.window {
+		c.ring = append(c.ring, h)
+	} else {
+		delete(c.seen, c.ring[c.next])
+		c.ring[c.next] = h
+		c.next = (c.next + 1) % c.window
+	}
+	c.seen[h] = gen
+	return false
+}
+
+// String describes the cycle for the status line.
+func (c *Cycle) String() string {
+	switch {
+	case c.Extinct:
+		return fmt.Sprintf("extinct at %d", c.Start)
+	case c.Period == 1:
+		return fmt.Sprintf("still from %d", c.Start)
+	case c.Period > 1:
+		return fmt.Sprintf("period %d from %d", c.Period, c.Start)
+	}
+	return ""
+}
+
+// mix64 is the finalizer of the splitmix64.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// hashRow adds the packed row to the hash h.
+func hashRow(h uint64, row []uint64) uint64 {
+	for _, v := range row {
+		h = mix64(h ^ v)
+	}
+	return h
+}
+
+// Hash returns the hash of the cells of the grid.
+func (g *Grid) Hash() uint64 {
+	h := mix64(uint64(g.cellsPerRow)<<32 | uint64(len(g.area)))
+	for _, row := range g.area {
+		h = hashRow(h, row)
+	}
+	return h
+}
+
+// Hash returns the hash of the cells of the plane, it does not depend
+// on the order of the tiles nor on the empty ones.
+func (s *Sparse) Hash() uint64 {
+	var sum uint64
+	for k, t := range s.tiles {
+		if *t == emptyTile {
+			// left by the erased cells until the next step
+			continue
+		}
+		h := mix64(uint64(uint32(k.x))<<32 | uint64(uint32(k.y)))
+		for iy := range t {
+			h = hashRow(h, t[iy][:])
+		}
+		sum += h
+	}
+	return sum
+}
@@ -0,0 +1,92 @@
+package convay
+
+import (
+	"testing"
+)
+
+// runCycle steps the universe until the cycle is found, at most n steps.
+func runCycle(u Universe, n int) *Cycle {
+	c := NewCycle(100)
+	for i := 0; i < n && !c.Observe(u, Census(u)); i++ {
+		u.Step()
+	}
+	return c
+}
+
+func TestCycleStill(t *testing.T) {
+	g := NewGrid(10, 10)
+	// the young cells of the block become old at the first step
+	g.SetDots(4, 4, "11")
+	g.SetDots(5, 4, "11")
+	c := runCycle(g, 10)
+	ExpectInt(t, "Period", c.Period, 1)
+	ExpectUint64(t, "Start", c.Start, 1)
+	if c.Extinct {
+		t.Error("block is extinct")
+	}
+	if c.String() != "still from 1" {
+		t.Errorf("invalid String %q", c.String())
+	}
+}
+
+func TestCycleBlinker(t *testing.T) {
+	r, _ := ParseRule("conway")
+	s := NewSparse()
+	s.SetRule(r)
+	s.SetDots(0, 0, "222")
+	c := runCycle(s, 10)
+	// the first generation is all old
+	ExpectInt(t, "Period", c.Period, 2)
+	ExpectUint64(t, "Start", c.Start, 1)
+	ExpectUint64(t, "Iterations", s.Iterations(), 3)
+}
+
+func TestCycleExtinct(t *testing.T) {
+	g := NewGrid(10, 10)
+	g.SetDots(4, 4, "22")
+	c := runCycle(g, 10)
+	if !c.Extinct {
+		t.Error("not extinct")
+	}
+	ExpectUint64(t, "Start", c.Start, 1)
+	c.Reset()
+	ExpectInt(t, "Period", c.Period, 0)
+}
+
+func TestCycleGlider(t *testing.T) {
+	// the glider comes back on the torus after 4 steps per cell
+	r, _ := ParseRule("conway")
+	g := NewGrid(8, 8)
+	g.SetRule(r)
+	g.InitConfig("glider")
+	c := runCycle(g, 100)
+	ExpectInt(t, "Period", c.Period, 32)
+	ExpectUint64(t, "Start", c.Start, 1)
+}
+
+func TestCycleWindow(t *testing.T) {
+	// the period is longer than the window
+	r, _ := ParseRule("conway")
+	g := NewGrid(8, 8)
+	g.SetRule(r)
+	g.InitConfig("glider")
+	c := NewCycle(20)
+	for i := 0; i < 100; i++ {
+		if c.Observe(g, Census(g)) {
+			t.Fatalf("found period %d", c.Period)
+		}
+		g.Step()
+	}
+}
+
+func TestSparseHashErased(t *testing.T) {
+	s := NewSparse()
+	s.Set(0, 0, Old)
+	h := s.Hash()
+	// the erased cell leaves the empty tile
+	s.Set(1000, 1000, Old)
+	s.Set(1000, 1000, Empty)
+	ExpectUint64(t, "hash", s.Hash(), h)
+	s.Set(0, 0, Empty)
+	ExpectUint64(t, "empty hash", s.Hash(), NewSparse().Hash())
+}
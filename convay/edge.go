@@ -0,0 +1,105 @@
+package convay
+
+import (
+	"fmt"
+)
+
+// Edge is the boundary mode of the grid, i.e. what are the neighbours
+// of the cells on the edges.
+type Edge int
+
+const (
+	EdgeTorus  Edge = iota // the edges wrap around
+	EdgeDead               // the cells outside are empty
+	EdgeMirror             // the cells outside are the copies of the edge cells
+	EdgeKlein              // like torus, but the top and the bottom are glued with a twist
+)
+
+var edgeNames = []string{"torus", "dead", "mirror", "klein"}
+
+func (e Edge) String() string {
+	if e < 0 || int(e) >= len(edgeNames) {
+		return fmt.Sprintf("Edge(%d)", int(e))
+	}
+	return edgeNames[e]
+}
+
+// Next returns the next edge mode, wrapping around after the last one.
+func (e Edge) Next() Edge {
+	return Edge((int(e) + 1) % len(edgeNames))
+}
+
+func ParseEdge(name string) (Edge, error) {
+	for i, n := range edgeNames {
+		if n == name {
+			return Edge(i), nil
+		}
+	}
+	return EdgeTorus, fmt.Errorf("unknown edge mode %q", name)
+}
+
+// Edge returns the boundary mode of the grid.
+func (g *Grid) Edge() Edge {
+	return g.edge
+}
+
+// SetEdge changes the boundary mode of the grid.
+func (g *Grid) SetEdge(e Edge) {
+	g.edge = e
+}
+
+// rowEdges returns the values of the virtual cells to the left and to
+// the right of the row.
+func (g *Grid) rowEdges(row []uint64) (left, right uint64) {
+	first := row[0] & CellMask
+	last := (row[len(row)-1] >> g.lastCellOffset) & CellMask
+	switch g.edge {
+	case EdgeDead:
+		return 0, 0
+	case EdgeMirror:
+		return first, last
+	}
+	return last, first
+}
+
+// triple makes the running sum of the row with the edges of the grid.
+func (g *Grid) triple(result []cellValue, row []uint64) {
+	left, right := g.rowEdges(row)
+	tripleRow(result, row, g.lastCellOffset, g.lastIntMask, left, right)
+}
+
+// halos makes the running sums of the virtual rows above the first and
+// below the last row.
+func (g *Grid) halos(top, bottom []cellValue) {
+	nrows := len(g.area)
+	switch g.edge {
+	case EdgeDead:
+		for i := range top {
+			top[i] = cellValue{}
+			bottom[i] = cellValue{}
+		}
+	case EdgeMirror:
+		g.triple(top, g.area[0])
+		g.triple(bottom, g.area[nrows-1])
+	case EdgeKlein:
+		rev := g.stepper.rev
+		g.reverseRow(rev, g.area[nrows-1])
+		g.triple(top, rev)
+		g.reverseRow(rev, g.area[0])
+		g.triple(bottom, rev)
+	default:
+		g.triple(top, g.area[nrows-1])
+		g.triple(bottom, g.area[0])
+	}
+}
+
+// reverseRow puts the cells of the row src into dst in reverse order.
+func (g *Grid) reverseRow(dst, src []uint64) {
+	for i := range dst {
+		dst[i] = 0
+	}
+	for x, rx := 0, g.cellsPerRow-1; rx >= 0; x, rx = x+1, rx-1 {
+		v := (src[x/CellsPerInt] >> uint((x%CellsPerInt)*BitsPerCell)) & CellMask
+		dst[rx/CellsPerInt] |= v << uint((rx%CellsPerInt)*BitsPerCell)
+	}
+}
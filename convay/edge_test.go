@@ -0,0 +1,69 @@
+package convay
+
+import (
+	"testing"
+)
+
+func TestParseEdge(t *testing.T) {
+	for _, e := range []Edge{EdgeTorus, EdgeDead, EdgeMirror, EdgeKlein} {
+		p, err := ParseEdge(e.String())
+		if err != nil || p != e {
+			t.Errorf("%v -> %v, %v", e, p, err)
+		}
+	}
+	if _, err := ParseEdge("sphere"); err == nil {
+		t.Error("unknown edge is accepted")
+	}
+	ExpectInt(t, "EdgeKlein.Next()", int(EdgeKlein.Next()), int(EdgeTorus))
+}
+
+func TestReverseRow(t *testing.T) {
+	g := randomGrid(37, 1, 11)
+	rev := make([]uint64, len(g.Row(0)))
+	g.reverseRow(rev, g.Row(0))
+	h := NewGrid(37, 1)
+	copy(h.Row(0), rev)
+	for x := 0; x < 37; x++ {
+		ExpectUint64(t, "reversed", h.Get(36-x, 0), g.Get(x, 0))
+	}
+}
+
+func TestGridStepEdges(t *testing.T) {
+	sizes := [][2]int{{1, 1}, {2, 3}, {7, 5}, {16, 4}, {17, 9}, {33, 12}}
+	for _, e := range []Edge{EdgeTorus, EdgeDead, EdgeMirror, EdgeKlein} {
+		for _, rule := range []string{DefaultRule, "conway", "daynight"} {
+			r, _ := ParseRule(rule)
+			for i, sz := range sizes {
+				g := randomGrid(sz[0], sz[1], int64(i))
+				g.SetRule(r)
+				g.SetEdge(e)
+				for n := 0; n < 8; n++ {
+					want := slowStep(g)
+					g.Step()
+					sameGrid(t, e.String()+" "+rule, g, want)
+				}
+			}
+		}
+	}
+}
+
+func TestGridDeadEdgeGlider(t *testing.T) {
+	// the glider runs forever on the torus, but it crashes into the dead
+	// edge and leaves a block in the corner
+	r, _ := ParseRule("conway")
+	for _, e := range []Edge{EdgeTorus, EdgeDead} {
+		g := NewGrid(10, 10)
+		g.SetRule(r)
+		g.SetEdge(e)
+		g.InitConfig("glider")
+		for n := 0; n < 40; n++ {
+			g.Step()
+		}
+		young, old := g.Counts()
+		want := 5
+		if e == EdgeDead {
+			want = 4
+		}
+		ExpectInt(t, e.String()+" cells", young+old, want)
+	}
+}
@@ -0,0 +1,347 @@
+// Package convay implements the young/old variant of the Conway's game
+// of life on a bit-packed grid, toroidal by default.  It does not depend
+// on GTK, so it can be used by the batch tools, tests and servers.
+package convay
+
+import (
+	"math/bits"
+	"runtime"
+)
+
+const BitsPerCell = 4
+const CellsPerInt = 64 / BitsPerCell
+const CellMask uint64 = (1 << BitsPerCell) - 1
+
+// The values of the cells.
+const (
+	Empty uint64 = 0x0
+	Young uint64 = 0x1
+	Old   uint64 = 0x4
+)
+
+// Grid is the area of cells.  Every row is packed into the uint64s,
+// CellsPerInt cells per int, the cell 0 is in the lowest bits.
+type Grid struct {
+	area           [][]uint64
+	cellsPerRow    int
+	lastIntMask    uint64
+	lastCellOffset uint
+	iterations     uint64 // the number of steps passed
+	rule           *Rule
+	edge           Edge
+	workers        int     // the number of goroutines in Step, 0 for GOMAXPROCS
+	stepper        stepper // the buffers of Step
+}
+
+func NewGrid(nx, ny int) *Grid {
+	g := new(Grid)
+	g.Init(nx, ny)
+	return g
+}
+
+func (g *Grid) Init(nx, ny int) {
+	g.setSize(nx, ny)
+	g.iterations = 0
+	g.stepper = stepper{}
+	if g.rule == nil {
+		g.rule = defaultRule
+	}
+}
+
+// setSize allocates the empty area of nx*ny cells.
+func (g *Grid) setSize(nx, ny int) {
+	if nx <= 0 {
+		panic("Too narrow area")
+	}
+	if ny <= 0 {
+		panic("Too short area")
+	}
+
+	rowLen := (nx + CellsPerInt - 1) / CellsPerInt
+	g.cellsPerRow = nx
+	lastIntCells := nx - CellsPerInt*(rowLen-1)
+	if lastIntCells <= 0 {
+		panic("Invalid lastIntCells")
+	}
+	// the mask of the last int in the row
+	g.lastIntMask = ^(^uint64(0) << uint(lastIntCells*BitsPerCell))
+	// the offset the the last cell in the last int
+	g.lastCellOffset = uint((lastIntCells - 1) * BitsPerCell)
+	g.area = make([][]uint64, 0, ny)
+	for i := 0; i < ny; i++ {
+		row := make([]uint64, rowLen)
+		g.area = append(g.area, row)
+	}
+}
+
+// Resize changes the size of the grid to nx*ny cells.  The cells keep
+// their coordinates, the ones outside of the new size are lost and the
+// new ones are empty.
+func (g *Grid) Resize(nx, ny int) {
+	old := g.area
+	g.setSize(nx, ny)
+	for iy, row := range g.area {
+		if iy == len(old) {
+			break
+		}
+		copy(row, old[iy])
+		// drop the cells beyond the new last one
+		row[len(row)-1] &= g.lastIntMask
+	}
+	g.stepper = stepper{}
+}
+
+// Width returns the number of cells in a row.
+func (g *Grid) Width() int {
+	return g.cellsPerRow
+}
+
+// Height returns the number of rows.
+func (g *Grid) Height() int {
+	return len(g.area)
+}
+
+// Iterations returns the number of steps passed.
+func (g *Grid) Iterations() uint64 {
+	return g.iterations
+}
+
+// Rule returns the rule of the grid.
+func (g *Grid) Rule() *Rule {
+	return g.rule
+}
+
+// SetRule changes the rule of the grid.
+func (g *Grid) SetRule(r *Rule) {
+	g.rule = r
+}
+
+// Workers returns the number of goroutines used by Step, 0 for GOMAXPROCS.
+func (g *Grid) Workers() int {
+	return g.workers
+}
+
+// SetWorkers changes the number of goroutines used by Step,
+// 0 means runtime.GOMAXPROCS.
+func (g *Grid) SetWorkers(n int) {
+	g.workers = n
+}
+
+// The minimal number of rows in a band, the smaller grids are stepped
+// in one goroutine.
+var minBandRows = 64
+
+// bands returns the number of the bands the rows are split into.
+func (g *Grid) bands() int {
+	n := g.workers
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	if max := len(g.area) / minBandRows; n > max {
+		n = max
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// Row returns the packed row y.  The row is owned by the grid and is
+// only valid until the next Step, which reuses it for the next state.
+func (g *Grid) Row(y int) []uint64 {
+	return g.area[y]
+}
+
+// wrap puts the coordinates into the area.
+func (g *Grid) wrap(x, y int) (int, int) {
+	x %= g.cellsPerRow
+	if x < 0 {
+		x += g.cellsPerRow
+	}
+	y %= len(g.area)
+	if y < 0 {
+		y += len(g.area)
+	}
+	return x, y
+}
+
+// Get returns the value of the cell, the coordinates wrap around.
+func (g *Grid) Get(x, y int) uint64 {
+	x, y = g.wrap(x, y)
+	shift := uint((x % CellsPerInt) * BitsPerCell)
+	return (g.area[y][x/CellsPerInt] >> shift) & CellMask
+}
+
+// Set changes the value of the cell, the coordinates wrap around.
+func (g *Grid) Set(x, y int, v uint64) {
+	x, y = g.wrap(x, y)
+	ix := x / CellsPerInt
+	shift := uint((x % CellsPerInt) * BitsPerCell)
+	g.area[y][ix] = g.area[y][ix] & ^(CellMask<<shift) | ((v & CellMask) << shift)
+}
+
+// ReadRow packs the cells of the row y starting from x0 into dst,
+// the coordinates wrap around.
+func (g *Grid) ReadRow(dst []uint64, x0, y int) {
+	_, y = g.wrap(0, y)
+	row := g.area[y]
+	for i := range dst {
+		x := x0 + i*CellsPerInt
+		if x >= 0 && x+CellsPerInt <= g.cellsPerRow {
+			// the whole word is inside the row
+			ix := x / CellsPerInt
+			off := uint(x%CellsPerInt) * BitsPerCell
+			v := row[ix] >> off
+			if off != 0 {
+				v |= row[ix+1] << (64 - off)
+			}
+			dst[i] = v
+			continue
+		}
+		var v uint64
+		for j := 0; j < CellsPerInt; j++ {
+			v |= g.Get(x+j, y) << uint(j*BitsPerCell)
+		}
+		dst[i] = v
+	}
+}
+
+// SetDots sets the cells starting from (x,y) to the right.
+// The dots are '0' for empty, '1' for young and '2' for old cells.
+func (g *Grid) SetDots(y, x int, dots string) {
+	for i := 0; i < len(dots); i++ {
+		var v uint64
+		switch dots[i] {
+		case '0':
+			v = Empty
+		case '1':
+			v = Young
+		case '2':
+			v = Old
+		}
+		g.Set(x, y, v)
+		x++
+	}
+}
+
+// InitConfig puts the named initial configuration into the centre of
+// the grid.  The empty name leaves the grid as is, the unknown name
+// makes a glider.
+func (g *Grid) InitConfig(name string) {
+	nx := g.Width()
+	ny := g.Height()
+	switch name {
+	case "line":
+		g.SetDots(ny/2, nx/2-3, "1222221")
+	case "kaka":
+		g.SetDots(ny/2+0, nx/2, "000000012")
+		g.SetDots(ny/2+1, nx/2, "2100010021")
+		g.SetDots(ny/2+2, nx/2, "0020210021")
+		g.SetDots(ny/2+3, nx/2, "222002122")
+		g.SetDots(ny/2+4, nx/2, "0110101")
+	case "":
+		// do nothing
+	default:
+		g.SetDots(ny/2, nx/2, "221")
+		g.SetDots(ny/2+1, nx/2, "002")
+		g.SetDots(ny/2+2, nx/2, "2")
+	}
+}
+
+// Clean removes all cells.
+func (g *Grid) Clean() {
+	g.CleanRows(0, len(g.area))
+}
+
+// CleanRows removes all cells in the rows [y0,y1).
+func (g *Grid) CleanRows(y0, y1 int) {
+	for iy := y0; iy < y1; iy++ {
+		for ix := 0; ix < len(g.area[iy]); ix++ {
+			g.area[iy][ix] = 0
+		}
+	}
+}
+
+// The bits of the young and the old cells of the packed int.
+const (
+	youngBits uint64 = 0x1111111111111111
+	oldBits   uint64 = 0x4444444444444444
+)
+
+// countInt returns the number of young and old cells in the packed int.
+func countInt(v uint64) (young, old int) {
+	return bits.OnesCount64(v & youngBits), bits.OnesCount64(v & oldBits)
+}
+
+// Counts returns the number of young and old cells.
+func (g *Grid) Counts() (young, old int) {
+	for _, row := range g.area {
+		for _, v := range row {
+			y, o := countInt(v)
+			young += y
+			old += o
+		}
+	}
+	return young, old
+}
+
+// Bounds returns the bounding box [x0,x1)x[y0,y1) of the live cells,
+// the empty box if there are none.  If the edges wrap around, the box is
+// the smallest one on the torus, so it may cross the edges: x1 and y1
+// are up to x0+Width and y0+Height then.
+func (g *Grid) Bounds() (x0, y0, x1, y1 int) {
+	cols := make([]bool, g.cellsPerRow)
+	rows := make([]bool, len(g.area))
+	for y, row := range g.area {
+		for ix, v := range row {
+			for i := 0; v != 0; i, v = i+1, v>>BitsPerCell {
+				if v&CellMask != Empty {
+					cols[ix*CellsPerInt+i] = true
+					rows[y] = true
+				}
+			}
+		}
+	}
+	wraps := g.edge == EdgeTorus || g.edge == EdgeKlein
+	x0, x1 = span(cols, wraps)
+	y0, y1 = span(rows, wraps)
+	return x0, y0, x1, y1
+}
+
+// span returns the smallest interval [a,b) with all used positions.  If
+// the positions wrap around, the interval is the complement of the
+// longest run of the unused ones on the circle, b may exceed len(used).
+func span(used []bool, wraps bool) (a, b int) {
+	first, last := -1, -1
+	for i, u := range used {
+		if u {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	if first < 0 {
+		return 0, 0
+	}
+	a, b = first, last+1
+	if !wraps {
+		return a, b
+	}
+	// the run over the edge is preferred, so the box crosses the edge
+	// only if it is smaller
+	gap := len(used) - b + a
+	run := 0
+	for i := first; i <= last; i++ {
+		if !used[i] {
+			run++
+			continue
+		}
+		if run > gap {
+			gap = run
+			a, b = i, i-run+len(used)
+		}
+		run = 0
+	}
+	return a, b
+}
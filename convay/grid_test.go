@@ -0,0 +1,293 @@
+package convay
+
+import (
+	"math/rand"
+	"runtime"
+	"testing"
+)
+
+const allset uint64 = 0xffffffffffffffff
+
+func ExpectInt(t *testing.T, s string, a, b int) {
+	if a != b {
+		_, fn, ln, ok := runtime.Caller(1)
+		if !ok {
+			fn = "???"
+			ln = 0
+		}
+		t.Errorf("@%s:%d invalid %s: %d != %d", fn, ln, s, a, b)
+	}
+}
+
+func ExpectUint(t *testing.T, s string, a, b uint) {
+	if a != b {
+		_, fn, ln, ok := runtime.Caller(1)
+		if !ok {
+			fn = "???"
+			ln = 0
+		}
+		t.Errorf("@%s:%d invalid %s: %d != %d", fn, ln, s, a, b)
+	}
+}
+
+func ExpectUint64(t *testing.T, s string, a, b uint64) {
+	if a != b {
+		_, fn, ln, ok := runtime.Caller(1)
+		if !ok {
+			fn = "???"
+			ln = 0
+		}
+		t.Errorf("@%s:%d invalid %s: %x != %x", fn, ln, s, a, b)
+	}
+}
+
+// randomGrid fills the grid with young and old cells.
+func randomGrid(nx, ny int, seed int64) *Grid {
+	g := NewGrid(nx, ny)
+	r := rand.New(rand.NewSource(seed))
+	for y := 0; y < ny; y++ {
+		for x := 0; x < nx; x++ {
+			switch r.Intn(6) {
+			case 0:
+				g.Set(x, y, Young)
+			case 1, 2:
+				g.Set(x, y, Old)
+			}
+		}
+	}
+	return g
+}
+
+// getEdge returns the value of the cell with the edge mode of the grid.
+func getEdge(g *Grid, x, y int) uint64 {
+	nx := g.Width()
+	ny := g.Height()
+	switch g.Edge() {
+	case EdgeDead:
+		if x < 0 || x >= nx || y < 0 || y >= ny {
+			return Empty
+		}
+	case EdgeMirror:
+		if x < 0 {
+			x = 0
+		} else if x >= nx {
+			x = nx - 1
+		}
+		if y < 0 {
+			y = 0
+		} else if y >= ny {
+			y = ny - 1
+		}
+	case EdgeKlein:
+		if y < 0 || y >= ny {
+			x = nx - 1 - x
+		}
+	}
+	return g.Get(x, y)
+}
+
+// slowStep is the cell by cell implementation of the rule.
+func slowStep(g *Grid) *Grid {
+	nx := g.Width()
+	ny := g.Height()
+	next := NewGrid(nx, ny)
+	next.SetRule(g.Rule())
+	next.SetEdge(g.Edge())
+	for y := 0; y < ny; y++ {
+		for x := 0; x < nx; x++ {
+			young := 0
+			total := 0
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					if dx == 0 && dy == 0 {
+						continue
+					}
+					switch getEdge(g, x+dx, y+dy) {
+					case Young:
+						young++
+						total++
+					case Old:
+						total++
+					}
+				}
+			}
+			r := g.Rule()
+			inB := r.Birth&(1<<uint(total)) != 0
+			inS := r.Survive&(1<<uint(total)) != 0
+			inY := r.Young == 0 || r.Young&(1<<uint(young)) != 0
+			v := Empty
+			switch g.Get(x, y) {
+			case Young:
+				if r.Young != 0 || inS {
+					v = Old
+				}
+			case Old:
+				if inS && inY {
+					v = Old
+				}
+			default:
+				if inB && inY {
+					v = Young
+				}
+			}
+			next.Set(x, y, v)
+		}
+	}
+	next.iterations = g.iterations + 1
+	return next
+}
+
+func sameGrid(t *testing.T, s string, a, b *Grid) {
+	if a.Width() != b.Width() || a.Height() != b.Height() {
+		t.Fatalf("%s: size %dx%d != %dx%d", s,
+			a.Width(), a.Height(), b.Width(), b.Height())
+	}
+	for y := 0; y < a.Height(); y++ {
+		ra := a.Row(y)
+		rb := b.Row(y)
+		for i := range ra {
+			if ra[i] != rb[i] {
+				t.Fatalf("%s: row %d int %d: %x != %x", s, y, i, ra[i], rb[i])
+			}
+		}
+	}
+}
+
+func TestGridInit7x5(t *testing.T) {
+	nx := 7
+	ny := 5
+	g := NewGrid(nx, ny)
+	ExpectInt(t, "len(g.area)", len(g.area), ny)
+	ExpectInt(t, "g.cellsPerRow", g.cellsPerRow, nx)
+	ExpectInt(t, "len(g.area[0])", len(g.area[0]), 1)
+	ExpectUint64(t, "g.lastIntMask", g.lastIntMask, 0xfffffff)
+	ExpectUint(t, "g.lastCellOffset", g.lastCellOffset, 24)
+}
+
+func TestGridInit800x5(t *testing.T) {
+	nx := 800
+	ny := 5
+	g := NewGrid(nx, ny)
+	ExpectInt(t, "len(g.area)", len(g.area), ny)
+	ExpectInt(t, "g.cellsPerRow", g.cellsPerRow, nx)
+	ExpectInt(t, "len(g.area[0])", len(g.area[0]), 50) // 800/16
+	ExpectUint64(t, "g.lastIntMask", g.lastIntMask, allset)
+	ExpectUint(t, "g.lastCellOffset", g.lastCellOffset, 60)
+}
+
+func TestGridGetSet(t *testing.T) {
+	g := NewGrid(20, 3)
+	g.Set(17, 1, Old)
+	g.Set(-1, -1, Young) // wraps to 19,2
+	ExpectUint64(t, "Get(17,1)", g.Get(17, 1), Old)
+	ExpectUint64(t, "Get(19,2)", g.Get(19, 2), Young)
+	ExpectUint64(t, "Get(39,5)", g.Get(39, 5), Young)
+	ExpectUint64(t, "row 1", g.Row(1)[1], Old<<4)
+	g.SetDots(0, 18, "212")
+	ExpectUint64(t, "Get(18,0)", g.Get(18, 0), Old)
+	ExpectUint64(t, "Get(19,0)", g.Get(19, 0), Young)
+	ExpectUint64(t, "Get(0,0)", g.Get(0, 0), Old)
+	young, old := g.Counts()
+	ExpectInt(t, "young", young, 2)
+	ExpectInt(t, "old", old, 3)
+	g.CleanRows(0, 2)
+	young, old = g.Counts()
+	ExpectInt(t, "young", young, 1)
+	ExpectInt(t, "old", old, 0)
+	g.Clean()
+	young, old = g.Counts()
+	ExpectInt(t, "young", young, 0)
+	ExpectInt(t, "old", old, 0)
+}
+
+func TestGridStep(t *testing.T) {
+	sizes := [][2]int{{1, 1}, {3, 3}, {7, 5}, {16, 4}, {17, 9}, {40, 40}, {100, 13}}
+	for i, sz := range sizes {
+		g := randomGrid(sz[0], sz[1], int64(i))
+		for n := 0; n < 8; n++ {
+			want := slowStep(g)
+			g.Step()
+			sameGrid(t, "step", g, want)
+		}
+		ExpectUint64(t, "iterations", g.Iterations(), 8)
+	}
+}
+
+func TestGridBounds(t *testing.T) {
+	g := NewGrid(40, 10)
+	x0, y0, x1, y1 := g.Bounds()
+	ExpectInt(t, "empty width", x1-x0, 0)
+	ExpectInt(t, "empty height", y1-y0, 0)
+	g.Set(30, 2, Young)
+	g.Set(5, 7, Old)
+	g.Set(17, 4, Old)
+	x0, y0, x1, y1 = g.Bounds()
+	ExpectInt(t, "x0", x0, 5)
+	ExpectInt(t, "y0", y0, 2)
+	ExpectInt(t, "x1", x1, 31)
+	ExpectInt(t, "y1", y1, 8)
+}
+
+func TestGridBoundsWrap(t *testing.T) {
+	// the glider crosses the edges of the torus, its box stays 3x3
+	r, _ := ParseRule("conway")
+	g := NewGrid(20, 12)
+	g.SetRule(r)
+	g.InitConfig("glider")
+	crossed := false
+	for n := 0; n < 80; n++ {
+		x0, y0, x1, y1 := g.Bounds()
+		if x1-x0 != 3 || y1-y0 != 3 {
+			t.Fatalf("step %d: box %d,%d-%d,%d", n, x0, y0, x1, y1)
+		}
+		if x1 > g.Width() || y1 > g.Height() {
+			crossed = true
+		}
+		g.Step()
+	}
+	if !crossed {
+		t.Error("the glider does not cross the edges")
+	}
+	// the Klein bottle wraps the same way, the box crosses the left and
+	// the right edges
+	g = NewGrid(20, 12)
+	g.SetEdge(EdgeKlein)
+	g.Set(19, 5, Old)
+	g.Set(1, 6, Old)
+	x0, y0, x1, y1 := g.Bounds()
+	ExpectInt(t, "klein x0", x0, 19)
+	ExpectInt(t, "klein x1", x1, 22)
+	ExpectInt(t, "klein y0", y0, 5)
+	ExpectInt(t, "klein y1", y1, 7)
+	// the dead edge does not wrap
+	g = NewGrid(20, 12)
+	g.SetEdge(EdgeDead)
+	g.Set(0, 0, Old)
+	g.Set(19, 0, Old)
+	x0, _, x1, _ = g.Bounds()
+	ExpectInt(t, "x0", x0, 0)
+	ExpectInt(t, "x1", x1, 20)
+}
+
+func TestGridResize(t *testing.T) {
+	sizes := [][2]int{{40, 40}, {17, 9}, {16, 4}, {100, 13}, {3, 3}, {33, 50}}
+	g := randomGrid(40, 40, 1)
+	ref := g.Clone()
+	for _, sz := range sizes {
+		g.Resize(sz[0], sz[1])
+		want := NewGrid(sz[0], sz[1])
+		for y := 0; y < sz[1]; y++ {
+			for x := 0; x < sz[0]; x++ {
+				if x < ref.Width() && y < ref.Height() {
+					want.Set(x, y, ref.Get(x, y))
+				}
+			}
+		}
+		sameGrid(t, "resize", g, want)
+		// the masks of the last int follow the new width
+		g.Step()
+		want.Step()
+		sameGrid(t, "step", g, want)
+		ref = g.Clone()
+	}
+}
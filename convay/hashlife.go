@@ -0,0 +1,496 @@
+package convay
+
+// HashLife is the memoized quadtree engine of the unbounded plane.  The
+// equal subtrees are shared, and the future of every subtree is computed
+// only once, so it can jump over 2^k generations of the regular patterns
+// in one call.
+//
+// The leaves of the tree are the 8x8 squares of packed cells, four of
+// them make 16 cells per row, i.e. exactly one int of the grid, and they
+// are stepped like the rows of the grid.
+//
+// The empty nodes are shared and never change, so Jump panics on the
+// rules with B0, under which the empty space is born.
+type HashLife struct {
+	root       *hlNode // centred on (0,0)
+	iterations uint64  // the number of generations passed
+	rule       *Rule
+	nodes      map[hlKey]*hlNode
+	leaves     map[hlRows]*hlNode
+	memo       map[hlMemoKey]*hlNode
+	empties    []*hlNode // the empty nodes by level
+	// MaxNodes is the number of nodes after which the memo is dropped.
+	MaxNodes int
+}
+
+const hlLeafBits = 3
+const hlLeafSize = 1 << hlLeafBits // the number of cells in the leaf side
+const hlLeafMask = hlLeafSize - 1
+
+// hlRows are the packed rows of the leaf.
+type hlRows [hlLeafSize]uint32
+
+// hlNode is the square of 2^level cells, the leaves are of the level
+// hlLeafBits.
+type hlNode struct {
+	nw, ne, sw, se *hlNode
+	level          uint
+	rows           hlRows // the cells of the leaf
+	young          int
+	old            int
+	next           *hlNode // the result of advance for 2^(level-2) generations
+}
+
+type hlKey struct {
+	nw, ne, sw, se *hlNode
+}
+
+type hlMemoKey struct {
+	n *hlNode
+	j uint // the jump is 2^j generations
+}
+
+const hlMinLevel = hlLeafBits + 3
+const hlMaxNodes = 1 << 22
+
+func NewHashLife() *HashLife {
+	h := new(HashLife)
+	h.rule = defaultRule
+	h.MaxNodes = hlMaxNodes
+	h.reset()
+	h.root = h.empty(hlMinLevel)
+	return h
+}
+
+func (h *HashLife) reset() {
+	h.nodes = make(map[hlKey]*hlNode)
+	h.leaves = make(map[hlRows]*hlNode)
+	h.memo = make(map[hlMemoKey]*hlNode)
+	h.empties = []*hlNode{h.leaf(hlRows{})}
+}
+
+// Iterations returns the number of generations passed.
+func (h *HashLife) Iterations() uint64 {
+	return h.iterations
+}
+
+// Rule returns the rule of the plane.
+func (h *HashLife) Rule() *Rule {
+	return h.rule
+}
+
+// SetRule changes the rule of the plane, the memo is dropped.
+func (h *HashLife) SetRule(r *Rule) {
+	if r == h.rule {
+		return
+	}
+	h.rule = r
+	h.compact()
+}
+
+// Nodes returns the number of the distinct nodes.
+func (h *HashLife) Nodes() int {
+	return len(h.nodes) + len(h.leaves)
+}
+
+// Counts returns the number of young and old cells.
+func (h *HashLife) Counts() (young, old int) {
+	return h.root.young, h.root.old
+}
+
+// Clean removes all cells.
+func (h *HashLife) Clean() {
+	h.root = h.empty(hlMinLevel)
+}
+
+// leaf returns the shared leaf with the given cells.
+func (h *HashLife) leaf(rows hlRows) *hlNode {
+	if n := h.leaves[rows]; n != nil {
+		return n
+	}
+	n := &hlNode{level: hlLeafBits, rows: rows}
+	for _, row := range rows {
+		for v := row; v != 0; v >>= BitsPerCell {
+			switch uint64(v) & CellMask {
+			case Young:
+				n.young++
+			case Old:
+				n.old++
+			}
+		}
+	}
+	h.leaves[rows] = n
+	return n
+}
+
+// join returns the shared node with the given quadrants.
+func (h *HashLife) join(nw, ne, sw, se *hlNode) *hlNode {
+	k := hlKey{nw, ne, sw, se}
+	if n := h.nodes[k]; n != nil {
+		return n
+	}
+	n := &hlNode{nw: nw, ne: ne, sw: sw, se: se, level: nw.level + 1}
+	n.young = nw.young + ne.young + sw.young + se.young
+	n.old = nw.old + ne.old + sw.old + se.old
+	h.nodes[k] = n
+	return n
+}
+
+func (h *HashLife) empty(level uint) *hlNode {
+	for hlLeafBits+uint(len(h.empties)) <= level {
+		e := h.empties[len(h.empties)-1]
+		h.empties = append(h.empties, h.join(e, e, e, e))
+	}
+	return h.empties[level-hlLeafBits]
+}
+
+func (n *hlNode) live() bool {
+	return n.young+n.old != 0
+}
+
+// half returns the half of the side of the root, i.e. the root covers
+// [-half,half) in both directions.
+func (h *HashLife) half() int {
+	return 1 << (h.root.level - 1)
+}
+
+// expand doubles the root around the centre.
+func (h *HashLife) expand() {
+	r := h.root
+	e := h.empty(r.level - 1)
+	h.root = h.join(
+		h.join(e, e, e, r.nw),
+		h.join(e, e, r.ne, e),
+		h.join(e, r.sw, e, e),
+		h.join(r.se, e, e, e))
+}
+
+// contains tells if the root covers (x,y).
+func (h *HashLife) contains(x, y int) bool {
+	half := h.half()
+	return x >= -half && x < half && y >= -half && y < half
+}
+
+// find returns the leaf containing (x,y) of the root and the local
+// coordinates of the cell in it.
+func (h *HashLife) find(x, y int) (n *hlNode, lx, ly int) {
+	n = h.root
+	x += h.half()
+	y += h.half()
+	for n.level > hlLeafBits {
+		half := 1 << (n.level - 1)
+		switch {
+		case x < half && y < half:
+			n = n.nw
+		case y < half:
+			n, x = n.ne, x-half
+		case x < half:
+			n, y = n.sw, y-half
+		default:
+			n, x, y = n.se, x-half, y-half
+		}
+	}
+	return n, x, y
+}
+
+// Get returns the value of the cell.
+func (h *HashLife) Get(x, y int) uint64 {
+	if !h.contains(x, y) {
+		return Empty
+	}
+	n, lx, ly := h.find(x, y)
+	return uint64(n.rows[ly]>>uint(lx*BitsPerCell)) & CellMask
+}
+
+// Set changes the value of the cell.
+func (h *HashLife) Set(x, y int, v uint64) {
+	for !h.contains(x, y) {
+		h.expand()
+	}
+	n, lx, ly := h.find(x, y)
+	rows := n.rows
+	shift := uint(lx * BitsPerCell)
+	rows[ly] = rows[ly] & ^uint32(CellMask<<shift) | uint32((v&CellMask)<<shift)
+	h.insert(x-lx, y-ly, h.leaf(rows))
+}
+
+// insert replaces the node of the same level with the top-left corner
+// at (x,y), which must be aligned to its size.
+func (h *HashLife) insert(x, y int, sub *hlNode) {
+	side := 1 << sub.level
+	for !h.contains(x, y) || !h.contains(x+side-1, y+side-1) {
+		h.expand()
+	}
+	half := h.half()
+	h.root = h.replace(h.root, x+half, y+half, sub)
+}
+
+func (h *HashLife) replace(n *hlNode, x, y int, sub *hlNode) *hlNode {
+	if n.level == sub.level {
+		return sub
+	}
+	half := 1 << (n.level - 1)
+	nw, ne, sw, se := n.nw, n.ne, n.sw, n.se
+	switch {
+	case x < half && y < half:
+		nw = h.replace(nw, x, y, sub)
+	case y < half:
+		ne = h.replace(ne, x-half, y, sub)
+	case x < half:
+		sw = h.replace(sw, x, y-half, sub)
+	default:
+		se = h.replace(se, x-half, y-half, sub)
+	}
+	return h.join(nw, ne, sw, se)
+}
+
+// walk calls fn for each live leaf of the node with the top-left
+// corner at (x,y).
+func (n *hlNode) walk(x, y int, fn func(x, y int, rows *hlRows)) {
+	if !n.live() {
+		return
+	}
+	if n.level == hlLeafBits {
+		fn(x, y, &n.rows)
+		return
+	}
+	half := 1 << (n.level - 1)
+	n.nw.walk(x, y, fn)
+	n.ne.walk(x+half, y, fn)
+	n.sw.walk(x, y+half, fn)
+	n.se.walk(x+half, y+half, fn)
+}
+
+// Load replaces the cells, the generation and the rule with the ones of
+// the plane.
+func (h *HashLife) Load(s *Sparse) {
+	h.Clean()
+	h.SetRule(s.rule)
+	h.iterations = s.iterations
+	for k, t := range s.tiles {
+		h.insert(k.x<<tileBits, k.y<<tileBits, h.tileNode(t, 0, 0, tileBits))
+	}
+}
+
+// tileNode makes the node of the given level out of the cells of the
+// tile starting from (x,y).
+func (h *HashLife) tileNode(t *tile, x, y int, level uint) *hlNode {
+	if level == hlLeafBits {
+		var rows hlRows
+		shift := uint((x % CellsPerInt) * BitsPerCell)
+		for i := range rows {
+			rows[i] = uint32(t[y+i][x/CellsPerInt] >> shift)
+		}
+		return h.leaf(rows)
+	}
+	half := 1 << (level - 1)
+	return h.join(
+		h.tileNode(t, x, y, level-1),
+		h.tileNode(t, x+half, y, level-1),
+		h.tileNode(t, x, y+half, level-1),
+		h.tileNode(t, x+half, y+half, level-1))
+}
+
+// Store replaces the cells and the generation of the plane with the
+// ones of the engine.
+func (h *HashLife) Store(s *Sparse) {
+	s.Clean()
+	half := h.half()
+	h.root.walk(-half, -half, func(x, y int, rows *hlRows) {
+		for iy, row := range rows {
+			for ix := 0; row != 0; ix, row = ix+1, row>>BitsPerCell {
+				if v := uint64(row) & CellMask; v != Empty {
+					s.Set(x+ix, y+iy, v)
+				}
+			}
+		}
+	})
+	s.iterations = h.iterations
+}
+
+// centre returns the central quarter of the node.
+func (h *HashLife) centre(n *hlNode) *hlNode {
+	if n.level == hlLeafBits+1 {
+		rows := n.pack()
+		return h.leaf(centreRows(&rows))
+	}
+	return h.join(n.nw.se, n.ne.sw, n.sw.ne, n.se.nw)
+}
+
+// pack returns the 16 rows of the node made of four leaves.
+func (n *hlNode) pack() (rows [2 * hlLeafSize]uint64) {
+	for i := 0; i < hlLeafSize; i++ {
+		rows[i] = uint64(n.nw.rows[i]) | uint64(n.ne.rows[i])<<32
+		rows[i+hlLeafSize] = uint64(n.sw.rows[i]) | uint64(n.se.rows[i])<<32
+	}
+	return rows
+}
+
+// centreRows returns the central 8x8 of the 16 rows.
+func centreRows(rows *[2 * hlLeafSize]uint64) (r hlRows) {
+	for i := range r {
+		r[i] = uint32(rows[i+hlLeafSize/2] >> (hlLeafSize / 2 * BitsPerCell))
+	}
+	return r
+}
+
+// inner tells if all live cells of the root are inside its central
+// 1/4 by 1/4 square.
+func (h *HashLife) inner() bool {
+	r := h.root
+	c := h.join(r.nw.se.se, r.ne.sw.sw, r.sw.ne.ne, r.se.nw.nw)
+	return c.young == r.young && c.old == r.old
+}
+
+// Jump advances the plane by 2^k generations.
+func (h *HashLife) Jump(k uint) {
+	if h.rule.Birth&1 != 0 {
+		panic("HashLife does not support B0 rules")
+	}
+	// the cells move at most one cell per generation, so the ones in
+	// the inner 1/4 stay within the central half returned by advance
+	for h.root.level < k+3 || !h.inner() {
+		h.expand()
+	}
+	h.root = h.advance(h.root, k)
+	h.iterations += 1 << k
+	if h.Nodes() > h.MaxNodes {
+		h.compact()
+	}
+}
+
+// Advance advances the plane by n generations.
+func (h *HashLife) Advance(n uint64) {
+	for k := uint(0); n != 0; k, n = k+1, n>>1 {
+		if n&1 != 0 {
+			h.Jump(k)
+		}
+	}
+}
+
+// Step advances the plane by one generation.
+func (h *HashLife) Step() {
+	h.Jump(0)
+}
+
+// advance returns the centre half of the node (above the leaves) after
+// 2^j generations, j <= level-2.
+func (h *HashLife) advance(n *hlNode, j uint) *hlNode {
+	if !n.live() {
+		return h.empty(n.level - 1)
+	}
+	full := j == n.level-2
+	if full && n.next != nil {
+		return n.next
+	}
+	key := hlMemoKey{n, j}
+	if !full {
+		if r := h.memo[key]; r != nil {
+			return r
+		}
+	}
+	var r *hlNode
+	switch {
+	case n.level == hlLeafBits+1:
+		r = h.base(n, j)
+	case full:
+		// the nine overlapping subsquares of the half size, both halves
+		// of the time are spent in them
+		c00, c01, c02 := h.advance(n.nw, j-1), h.advance(h.top(n), j-1), h.advance(n.ne, j-1)
+		c10, c11, c12 := h.advance(h.left(n), j-1), h.advance(h.centre(n), j-1), h.advance(h.right(n), j-1)
+		c20, c21, c22 := h.advance(n.sw, j-1), h.advance(h.bottom(n), j-1), h.advance(n.se, j-1)
+		r = h.join(
+			h.advance(h.join(c00, c01, c10, c11), j-1),
+			h.advance(h.join(c01, c02, c11, c12), j-1),
+			h.advance(h.join(c10, c11, c20, c21), j-1),
+			h.advance(h.join(c11, c12, c21, c22), j-1))
+	default:
+		// the shorter jump, the subsquares are only centred
+		c00, c01, c02 := h.centre(n.nw), h.centre(h.top(n)), h.centre(n.ne)
+		c10, c11, c12 := h.centre(h.left(n)), h.centre(h.centre(n)), h.centre(h.right(n))
+		c20, c21, c22 := h.centre(n.sw), h.centre(h.bottom(n)), h.centre(n.se)
+		r = h.join(
+			h.advance(h.join(c00, c01, c10, c11), j),
+			h.advance(h.join(c01, c02, c11, c12), j),
+			h.advance(h.join(c10, c11, c20, c21), j),
+			h.advance(h.join(c11, c12, c21, c22), j))
+	}
+	if full {
+		n.next = r
+	} else {
+		h.memo[key] = r
+	}
+	return r
+}
+
+// top, left, right and bottom return the subsquares of the half size
+// between the quadrants of the node.
+func (h *HashLife) top(n *hlNode) *hlNode {
+	return h.join(n.nw.ne, n.ne.nw, n.nw.se, n.ne.sw)
+}
+
+func (h *HashLife) left(n *hlNode) *hlNode {
+	return h.join(n.nw.sw, n.nw.se, n.sw.nw, n.sw.ne)
+}
+
+func (h *HashLife) right(n *hlNode) *hlNode {
+	return h.join(n.ne.sw, n.ne.se, n.se.nw, n.se.ne)
+}
+
+func (h *HashLife) bottom(n *hlNode) *hlNode {
+	return h.join(n.sw.ne, n.se.nw, n.sw.se, n.se.sw)
+}
+
+// base returns the central 8x8 of the 16x16 node after 2^j generations.
+// The 16 cells of the row are one int, so the node is stepped like the
+// grid with the dead edges, which do not reach the centre in time.
+func (h *HashLife) base(n *hlNode, j uint) *hlNode {
+	rows := n.pack()
+	for i := 0; i < 1<<j; i++ {
+		h.step16(&rows)
+	}
+	return h.leaf(centreRows(&rows))
+}
+
+// step16 makes one generation of the 16x16 square with the dead edges.
+func (h *HashLife) step16(rows *[2 * hlLeafSize]uint64) {
+	const lim = ^uint64(0)
+	const lco = uint((CellsPerInt - 1) * BitsPerCell)
+	// sums[i+1] is the running sum of the row i, the ones outside are 0
+	var sums [2*hlLeafSize + 2]cellValue
+	for i := range rows {
+		tripleRow(sums[i+1:i+2], rows[i:i+1], lco, lim, 0, 0)
+	}
+	var counts [1]cellValue
+	for i := range rows {
+		arg := [3][]cellValue{sums[i : i+1], sums[i+1 : i+2], sums[i+2 : i+3]}
+		sumup8(counts[:], &arg, rows[i:i+1])
+		// the row i-1 of sums is already used, so the row can be updated
+		rows[i] = h.rule.next(rows[i], counts[0])
+	}
+}
+
+// compact drops the memo and the nodes which are not used by the root.
+func (h *HashLife) compact() {
+	old := h.root
+	h.reset()
+	seen := make(map[*hlNode]*hlNode)
+	h.root = h.copyNode(old, seen)
+}
+
+func (h *HashLife) copyNode(n *hlNode, seen map[*hlNode]*hlNode) *hlNode {
+	if !n.live() {
+		return h.empty(n.level)
+	}
+	if n.level == hlLeafBits {
+		return h.leaf(n.rows)
+	}
+	if r := seen[n]; r != nil {
+		return r
+	}
+	r := h.join(
+		h.copyNode(n.nw, seen), h.copyNode(n.ne, seen),
+		h.copyNode(n.sw, seen), h.copyNode(n.se, seen))
+	seen[n] = r
+	return r
+}
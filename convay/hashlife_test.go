@@ -0,0 +1,155 @@
+package convay
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// randomSparse fills the square around (0,0) with young and old cells.
+func randomSparse(size int, seed int64) *Sparse {
+	s := NewSparse()
+	rnd := rand.New(rand.NewSource(seed))
+	for y := -size / 2; y < size/2; y++ {
+		for x := -size / 2; x < size/2; x++ {
+			switch rnd.Intn(4) {
+			case 0:
+				s.Set(x, y, Young)
+			case 1:
+				s.Set(x, y, Old)
+			}
+		}
+	}
+	return s
+}
+
+func sameSparse(t *testing.T, s string, a, b *Sparse) {
+	ax0, ay0, ax1, ay1 := a.Bounds()
+	bx0, by0, bx1, by1 := b.Bounds()
+	if ax0 != bx0 || ay0 != by0 || ax1 != bx1 || ay1 != by1 {
+		t.Fatalf("%s: bounds (%d,%d)-(%d,%d) != (%d,%d)-(%d,%d)", s,
+			ax0, ay0, ax1, ay1, bx0, by0, bx1, by1)
+	}
+	for y := ay0; y < ay1; y++ {
+		for x := ax0; x < ax1; x++ {
+			if a.Get(x, y) != b.Get(x, y) {
+				t.Fatalf("%s: (%d,%d) %x != %x", s, x, y, a.Get(x, y), b.Get(x, y))
+			}
+		}
+	}
+	ExpectUint64(t, s+" iterations", a.Iterations(), b.Iterations())
+}
+
+func TestHashLifeGetSet(t *testing.T) {
+	h := NewHashLife()
+	h.Set(-1, -1, Young)
+	h.Set(1000, -3, Old)
+	ExpectUint64(t, "(-1,-1)", h.Get(-1, -1), Young)
+	ExpectUint64(t, "(1000,-3)", h.Get(1000, -3), Old)
+	ExpectUint64(t, "(0,0)", h.Get(0, 0), Empty)
+	ExpectUint64(t, "(-5000,0)", h.Get(-5000, 0), Empty)
+	young, old := h.Counts()
+	ExpectInt(t, "young", young, 1)
+	ExpectInt(t, "old", old, 1)
+	h.Set(-1, -1, Empty)
+	young, old = h.Counts()
+	ExpectInt(t, "young", young, 0)
+	ExpectInt(t, "old", old, 1)
+}
+
+// TestHashLifeJump compares the jumps with the single steps of the
+// sparse plane.
+func TestHashLifeJump(t *testing.T) {
+	for i, rule := range []string{DefaultRule, "conway", "highlife"} {
+		r, _ := ParseRule(rule)
+		s := randomSparse(50, int64(i))
+		s.SetRule(r)
+		h := NewHashLife()
+		h.Load(s)
+		for _, k := range []uint{0, 3, 1, 6, 2} {
+			for n := 0; n < 1<<k; n++ {
+				s.Step()
+			}
+			h.Jump(k)
+			got := NewSparse()
+			h.Store(got)
+			sameSparse(t, rule, got, s)
+		}
+		young, old := s.Counts()
+		hy, ho := h.Counts()
+		ExpectInt(t, "young", hy, young)
+		ExpectInt(t, "old", ho, old)
+	}
+}
+
+// TestHashLifeGrid compares the jump of 100 generations with the steps
+// of the 256x256 dead edge grid, the soup in its central 32x32 square
+// stays away from the edges.
+func TestHashLifeGrid(t *testing.T) {
+	g := NewGrid(256, 256)
+	g.SetEdge(EdgeDead)
+	h := NewHashLife()
+	rnd := rand.New(rand.NewSource(3))
+	for y := 112; y < 144; y++ {
+		for x := 112; x < 144; x++ {
+			if rnd.Intn(3) == 0 {
+				g.Set(x, y, Old)
+				h.Set(x, y, Old)
+			}
+		}
+	}
+	for n := 0; n < 100; n++ {
+		g.Step()
+	}
+	h.Advance(100)
+	ExpectUint64(t, "iterations", h.Iterations(), 100)
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 256; x++ {
+			if g.Get(x, y) != h.Get(x, y) {
+				t.Fatalf("(%d,%d) %x != %x", x, y, h.Get(x, y), g.Get(x, y))
+			}
+		}
+	}
+}
+
+func TestHashLifeGlider(t *testing.T) {
+	// the glider is memoized, the long jump is cheap
+	r, _ := ParseRule("conway")
+	s := NewSparse()
+	s.SetRule(r)
+	s.InitConfig("glider")
+	h := NewHashLife()
+	h.Load(s)
+	h.Jump(40)
+	young, old := h.Counts()
+	ExpectInt(t, "cells", young+old, 5)
+	h.Store(s)
+	x0, _, _, _ := s.Bounds()
+	ExpectInt(t, "distance", x0, 1<<38)
+	ExpectUint64(t, "iterations", s.Iterations(), 1<<40)
+}
+
+func TestHashLifeCompact(t *testing.T) {
+	s := randomSparse(40, 5)
+	h := NewHashLife()
+	h.MaxNodes = 1000
+	h.Load(s)
+	for n := 0; n < 20; n++ {
+		s.Step()
+		h.Step()
+	}
+	if h.Nodes() > 2000 {
+		t.Errorf("too many nodes: %d", h.Nodes())
+	}
+	got := NewSparse()
+	h.Store(got)
+	sameSparse(t, "compact", got, s)
+}
+
+func BenchmarkHashLifeJump(b *testing.B) {
+	s := randomSparse(200, 1)
+	for i := 0; i < b.N; i++ {
+		h := NewHashLife()
+		h.Load(s)
+		h.Jump(10)
+	}
+}
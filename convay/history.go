@@ -0,0 +1,130 @@
+package convay
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Sample is the population of one generation.
+type Sample struct {
+	Generation uint64
+	Young      int
+	Old        int
+}
+
+func (s Sample) Total() int {
+	return s.Young + s.Old
+}
+
+// History is the rolling history of the population, it keeps the last
+// samples up to its size.
+type History struct {
+	samples []Sample
+	first   int // the index of the oldest sample once the ring is full
+}
+
+func NewHistory(size int) *History {
+	h := new(History)
+	h.samples = make([]Sample, 0, size)
+	return h
+}
+
+// Len returns the number of samples.
+func (h *History) Len() int {
+	return len(h.samples)
+}
+
+// At returns the i-th sample, 0 is the oldest one.
+func (h *History) At(i int) Sample {
+	return h.samples[(h.first+i)%len(h.samples)]
+}
+
+// Last returns the newest sample, the zero one if there are none.
+func (h *History) Last() Sample {
+	if len(h.samples) == 0 {
+		return Sample{}
+	}
+	return h.At(len(h.samples) - 1)
+}
+
+// Reset removes all samples.
+func (h *History) Reset() {
+	h.samples = h.samples[:0]
+	h.first = 0
+}
+
+// Census returns the population of the current generation of the
+// universe.  It scans all cells, so it is taken once per generation and
+// shared by its users.
+func Census(u Universe) Sample {
+	var s Sample
+	s.Generation = u.Iterations()
+	s.Young, s.Old = u.Counts()
+	return s
+}
+
+// Add records the population sample, see Census.  The sample of the
+// same generation is replaced, e.g. after the cells are edited, and the
+// later ones are dropped if the generation goes back.
+func (h *History) Add(s Sample) {
+	for h.Len() > 0 && h.Last().Generation >= s.Generation {
+		h.dropLast()
+	}
+	if len(h.samples) < cap(h.samples) {
+		h.samples = append(h.samples, s)
+		return
+	}
+	h.samples[h.first] = s
+	h.first = (h.first + 1) % len(h.samples)
+}
+
+// dropLast removes the newest sample.
+func (h *History) dropLast() {
+	n := len(h.samples)
+	if h.first == 0 {
+		h.samples = h.samples[:n-1]
+		return
+	}
+	// unroll the full ring, so that the oldest sample is the first
+	rolled := append(h.samples[h.first:n:n], h.samples[:h.first]...)
+	h.samples = append(h.samples[:0], rolled[:n-1]...)
+	h.first = 0
+}
+
+// Max returns the largest total population of the samples.
+func (h *History) Max() int {
+	m := 0
+	for _, s := range h.samples {
+		if s.Total() > m {
+			m = s.Total()
+		}
+	}
+	return m
+}
+
+// WriteCSV writes the samples from the oldest one as the CSV with the
+// step,young,old,total columns.
+func (h *History) WriteCSV(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "step,young,old,total")
+	for i := 0; i < h.Len(); i++ {
+		s := h.At(i)
+		fmt.Fprintf(bw, "%d,%d,%d,%d\n", s.Generation, s.Young, s.Old, s.Total())
+	}
+	return bw.Flush()
+}
+
+// SaveCSV writes the samples into the file.
+func (h *History) SaveCSV(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err = h.WriteCSV(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
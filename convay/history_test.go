@@ -0,0 +1,61 @@
+package convay
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestHistoryAdd(t *testing.T) {
+	g := NewGrid(10, 10)
+	g.SetDots(1, 1, "12")
+	h := NewHistory(3)
+	h.Add(Census(g))
+	g.Set(5, 5, Old)
+	h.Add(Census(g)) // the same generation
+	ExpectInt(t, "Len", h.Len(), 1)
+	ExpectInt(t, "Old", h.Last().Old, 2)
+	for i := 0; i < 4; i++ {
+		g.Step()
+		h.Add(Census(g))
+	}
+	ExpectInt(t, "Len", h.Len(), 3)
+	ExpectUint64(t, "At(0)", h.At(0).Generation, 2)
+	ExpectUint64(t, "Last", h.Last().Generation, 4)
+	g.Clean()
+	g.iterations = 1
+	h.Add(Census(g)) // back in time
+	ExpectInt(t, "Len", h.Len(), 1)
+	ExpectInt(t, "Max", h.Max(), 0)
+}
+
+func TestHistoryWriteCSV(t *testing.T) {
+	g := NewGrid(10, 10)
+	g.SetDots(1, 1, "1222")
+	h := NewHistory(10)
+	h.Add(Census(g))
+	g.Step()
+	h.Add(Census(g))
+	ExpectInt(t, "Max", h.Max(), 7)
+	var buf bytes.Buffer
+	if err := h.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "step,young,old,total\n0,1,3,4\n1,4,3,7\n"
+	if buf.String() != want {
+		t.Errorf("invalid CSV:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestHistoryBack(t *testing.T) {
+	g := NewGrid(10, 10)
+	h := NewHistory(4)
+	for i := 0; i < 6; i++ {
+		h.Add(Census(g))
+		g.Step()
+	}
+	g.iterations = 3
+	h.Add(Census(g))
+	ExpectInt(t, "Len", h.Len(), 2)
+	ExpectUint64(t, "At(0)", h.At(0).Generation, 2)
+	ExpectUint64(t, "Last", h.Last().Generation, 3)
+}
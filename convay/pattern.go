@@ -0,0 +1,205 @@
+package convay
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Pattern is a rectangle of cells, e.g. loaded from a pattern file.
+type Pattern struct {
+	Name   string
+	Width  int
+	Height int
+	cells  []uint64 // the values of the cells row by row
+}
+
+func NewPattern(w, h int) *Pattern {
+	p := new(Pattern)
+	p.Width = w
+	p.Height = h
+	p.cells = make([]uint64, w*h)
+	return p
+}
+
+// Get returns the value of the cell, or Empty outside of the pattern.
+func (p *Pattern) Get(x, y int) uint64 {
+	if x < 0 || x >= p.Width || y < 0 || y >= p.Height {
+		return Empty
+	}
+	return p.cells[y*p.Width+x]
+}
+
+// Set changes the value of the cell, the cells outside are ignored.
+func (p *Pattern) Set(x, y int, v uint64) {
+	if x < 0 || x >= p.Width || y < 0 || y >= p.Height {
+		return
+	}
+	p.cells[y*p.Width+x] = v & CellMask
+}
+
+// newPatternFromRows makes a pattern out of the rows of different length.
+func newPatternFromRows(rows [][]uint64, w, h int) *Pattern {
+	if h < len(rows) {
+		h = len(rows)
+	}
+	for _, row := range rows {
+		if w < len(row) {
+			w = len(row)
+		}
+	}
+	p := NewPattern(w, h)
+	for y, row := range rows {
+		copy(p.cells[y*w:], row)
+	}
+	return p
+}
+
+// ParseState converts the name of the state into the cell value.
+func ParseState(name string) (uint64, error) {
+	switch name {
+	case "young":
+		return Young, nil
+	case "old":
+		return Old, nil
+	}
+	return Empty, fmt.Errorf("unknown cell state %q", name)
+}
+
+// LoadPattern reads the pattern file, the format is selected by the
+// extension: .rle is the RLE, everything else is plaintext (.cells).
+// The live cells of the standard formats become the cells of the
+// state live.
+func LoadPattern(name string, live uint64) (*Pattern, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var p *Pattern
+	if strings.ToLower(filepath.Ext(name)) == ".rle" {
+		p, err = ReadRLE(f, live)
+	} else {
+		p, err = ReadCells(f, live)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	if p.Name == "" {
+		p.Name = strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	}
+	return p, nil
+}
+
+// PlacePatternFile loads the pattern file with the live cells of the
+// named state and places it in the centre of the universe moved by
+// (dx,dy).
+func PlacePatternFile(u Universe, name, state string, dx, dy int) error {
+	live, err := ParseState(state)
+	if err != nil {
+		return err
+	}
+	p, err := LoadPattern(name, live)
+	if err != nil {
+		return err
+	}
+	u.PlaceCentered(p, dx, dy)
+	return nil
+}
+
+// Place copies the pattern into the grid with its top-left corner at
+// (x,y).  The pattern wraps around the edges of the grid.
+func (g *Grid) Place(p *Pattern, x, y int) {
+	for py := 0; py < p.Height; py++ {
+		for px := 0; px < p.Width; px++ {
+			g.Set(x+px, y+py, p.Get(px, py))
+		}
+	}
+}
+
+// PlaceCentered places the pattern into the centre of the grid shifted
+// by (dx,dy).
+func (g *Grid) PlaceCentered(p *Pattern, dx, dy int) {
+	g.Place(p, (g.Width()-p.Width)/2+dx, (g.Height()-p.Height)/2+dy)
+}
+
+// CopyPattern copies the w*h cells of the universe with the top-left
+// corner at (x,y) into the new pattern.  The cells wrap around the
+// edges of the grid.
+func CopyPattern(u Universe, x, y, w, h int) *Pattern {
+	p := NewPattern(w, h)
+	for py := 0; py < h; py++ {
+		for px := 0; px < w; px++ {
+			p.Set(px, py, u.Get(x+px, y+py))
+		}
+	}
+	return p
+}
+
+// ClearRect removes the w*h cells of the universe with the top-left
+// corner at (x,y).
+func ClearRect(u Universe, x, y, w, h int) {
+	for py := 0; py < h; py++ {
+		for px := 0; px < w; px++ {
+			u.Set(x+px, y+py, Empty)
+		}
+	}
+}
+
+// Soup fills the w*h cells of the universe with the top-left corner at
+// (x,y) with the random cells: the share density of them are live, the
+// share young of those are young and the others old.  The same seed
+// makes the same soup.
+func Soup(u Universe, x, y, w, h int, density, young float64, seed int64) {
+	r := rand.New(rand.NewSource(seed))
+	for py := 0; py < h; py++ {
+		for px := 0; px < w; px++ {
+			v := Empty
+			if r.Float64() < density {
+				v = Old
+				if r.Float64() < young {
+					v = Young
+				}
+			}
+			u.Set(x+px, y+py, v)
+		}
+	}
+}
+
+// Rotate returns the pattern rotated clockwise by 90 degrees.
+func (p *Pattern) Rotate() *Pattern {
+	r := NewPattern(p.Height, p.Width)
+	r.Name = p.Name
+	for y := 0; y < p.Height; y++ {
+		for x := 0; x < p.Width; x++ {
+			r.Set(p.Height-1-y, x, p.Get(x, y))
+		}
+	}
+	return r
+}
+
+// FlipX returns the pattern mirrored left to right.
+func (p *Pattern) FlipX() *Pattern {
+	r := NewPattern(p.Width, p.Height)
+	r.Name = p.Name
+	for y := 0; y < p.Height; y++ {
+		for x := 0; x < p.Width; x++ {
+			r.Set(p.Width-1-x, y, p.Get(x, y))
+		}
+	}
+	return r
+}
+
+// FlipY returns the pattern mirrored top to bottom.
+func (p *Pattern) FlipY() *Pattern {
+	r := NewPattern(p.Width, p.Height)
+	r.Name = p.Name
+	for y := 0; y < p.Height; y++ {
+		for x := 0; x < p.Width; x++ {
+			r.Set(x, p.Height-1-y, p.Get(x, y))
+		}
+	}
+	return r
+}
@@ -0,0 +1,127 @@
+package convay
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlaceWraps(t *testing.T) {
+	p := NewPattern(3, 2)
+	p.Set(0, 0, Young)
+	p.Set(2, 1, Old)
+	p.Set(3, 1, Old) // outside, ignored
+	g := NewGrid(20, 5)
+	g.Set(0, 0, Old)
+	g.Place(p, 18, 4)
+	ExpectUint64(t, "(18,4)", g.Get(18, 4), Young)
+	ExpectUint64(t, "(0,0)", g.Get(0, 0), Old)
+	ExpectUint64(t, "(19,4)", g.Get(19, 4), Empty)
+	young, old := g.Counts()
+	ExpectInt(t, "young", young, 1)
+	ExpectInt(t, "old", old, 1)
+	g.Place(p, 19, 0)
+	ExpectUint64(t, "(1,1)", g.Get(1, 1), Old)
+	ExpectUint64(t, "(0,0)", g.Get(0, 0), Empty)
+}
+
+func TestPlacePatternFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "blinker.cells")
+	if err := os.WriteFile(name, []byte("!Name: blinker\nOOO\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	g := NewGrid(20, 20)
+	if err := PlacePatternFile(g, name, "young", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	young, old := g.Counts()
+	ExpectInt(t, "young", young, 3)
+	ExpectInt(t, "old", old, 0)
+	if err := PlacePatternFile(g, name, "dead", 0, 0); err == nil {
+		t.Error("no error for the invalid state")
+	}
+	if err := PlacePatternFile(g, name+".none", "old", 0, 0); err == nil {
+		t.Error("no error for the missing file")
+	}
+}
+
+func TestParseState(t *testing.T) {
+	if v, err := ParseState("young"); err != nil || v != Young {
+		t.Errorf("young -> %x, %v", v, err)
+	}
+	if v, err := ParseState("old"); err != nil || v != Old {
+		t.Errorf("old -> %x, %v", v, err)
+	}
+	if _, err := ParseState("dead"); err == nil {
+		t.Error("unknown state is accepted")
+	}
+}
+
+func TestCopyPattern(t *testing.T) {
+	g := NewGrid(20, 5)
+	g.SetDots(4, 18, "12")
+	g.SetDots(0, 0, "2")
+	// the rectangle wraps around the corner
+	p := CopyPattern(g, 18, 4, 3, 2)
+	ExpectInt(t, "Width", p.Width, 3)
+	ExpectUint64(t, "(0,0)", p.Get(0, 0), Young)
+	ExpectUint64(t, "(1,0)", p.Get(1, 0), Old)
+	ExpectUint64(t, "(2,1)", p.Get(2, 1), Old)
+	ClearRect(g, 18, 4, 3, 2)
+	young, old := g.Counts()
+	ExpectInt(t, "young", young, 0)
+	ExpectInt(t, "old", old, 0)
+}
+
+func TestSoup(t *testing.T) {
+	g := NewGrid(100, 100)
+	g.Set(0, 0, Old)
+	Soup(g, 10, 20, 50, 40, 0.3, 0.25, 42)
+	ExpectUint64(t, "outside", g.Get(0, 0), Old)
+	young, old := g.Counts()
+	live := young + old - 1
+	if live < 450 || live > 750 {
+		t.Errorf("%d live cells of 2000 at the density 0.3", live)
+	}
+	if young < live/8 || young > live*3/8 {
+		t.Errorf("%d young cells of %d at the ratio 0.25", young, live)
+	}
+	if x0, y0, x1, y1 := g.Bounds(); x0 != 0 || y0 != 0 || x1 > 60 || y1 > 60 {
+		t.Errorf("soup outside of the rectangle: %d,%d %d,%d", x0, y0, x1, y1)
+	}
+	// the same seed, the same soup over the old one
+	h := g.Hash()
+	Soup(g, 10, 20, 50, 40, 0.9, 0.9, 42)
+	Soup(g, 10, 20, 50, 40, 0.3, 0.25, 42)
+	ExpectUint64(t, "hash", g.Hash(), h)
+}
+
+func TestPatternTransform(t *testing.T) {
+	// .O
+	// ..
+	// Oo
+	p := NewPattern(2, 3)
+	p.Set(1, 0, Old)
+	p.Set(0, 2, Old)
+	p.Set(1, 2, Young)
+	r := p.Rotate()
+	ExpectInt(t, "Width", r.Width, 3)
+	ExpectInt(t, "Height", r.Height, 2)
+	// O..
+	// o.O
+	ExpectUint64(t, "rotate (0,0)", r.Get(0, 0), Old)
+	ExpectUint64(t, "rotate (0,1)", r.Get(0, 1), Young)
+	ExpectUint64(t, "rotate (2,1)", r.Get(2, 1), Old)
+	f := p.FlipX()
+	ExpectUint64(t, "flipx (0,0)", f.Get(0, 0), Old)
+	ExpectUint64(t, "flipx (0,2)", f.Get(0, 2), Young)
+	f = p.FlipY()
+	ExpectUint64(t, "flipy (1,0)", f.Get(1, 0), Young)
+	ExpectUint64(t, "flipy (1,2)", f.Get(1, 2), Old)
+	q := r.Rotate().Rotate().Rotate()
+	for y := 0; y < p.Height; y++ {
+		for x := 0; x < p.Width; x++ {
+			ExpectUint64(t, "rotate 4 times", q.Get(x, y), p.Get(x, y))
+		}
+	}
+}
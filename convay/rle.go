@@ -0,0 +1,139 @@
+package convay
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxRLECells is the largest area of the RLE pattern, so that a broken
+// file does not exhaust the memory.
+const maxRLECells = 1 << 24
+
+// ReadRLE reads the pattern in the Golly RLE format.
+// The live cells 'o' get the value live.  The multistate cells are our
+// extension: 'A' is a young cell and 'B' is an old cell, '.' is empty.
+// The cells must fit into the size of the header.
+func ReadRLE(r io.Reader, live uint64) (*Pattern, error) {
+	var rows [][]uint64
+	var row []uint64
+	name := ""
+	w := 0
+	h := 0
+	header := false
+	done := false
+	count := 0 // the run count may continue on the next line
+	scanner := bufio.NewScanner(r)
+	for lineno := 1; !done && scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") {
+			if strings.HasPrefix(line, "#N") {
+				name = strings.TrimSpace(line[2:])
+			}
+			continue
+		}
+		if !header {
+			if line == "" {
+				continue
+			}
+			var err error
+			if w, h, err = parseRLEHeader(line); err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineno, err)
+			}
+			header = true
+			continue
+		}
+		for i := 0; i < len(line); i++ {
+			c := line[i]
+			if c >= '0' && c <= '9' {
+				count = count*10 + int(c-'0')
+				continue
+			}
+			n := count
+			if n == 0 {
+				n = 1
+			}
+			count = 0
+			var v uint64
+			switch c {
+			case 'b', '.':
+				v = Empty
+			case 'o':
+				v = live
+			case 'A':
+				v = Young
+			case 'B':
+				v = Old
+			case '$':
+				if len(rows)+n > h {
+					return nil, fmt.Errorf("line %d: more than %d rows", lineno, h)
+				}
+				rows = append(rows, row)
+				for ; n > 1; n-- {
+					rows = append(rows, nil)
+				}
+				row = nil
+				continue
+			case '!':
+				done = true
+			case ' ', '\t':
+				continue
+			default:
+				return nil, fmt.Errorf("line %d: invalid cell %q", lineno, c)
+			}
+			if done {
+				break
+			}
+			if len(row)+n > w || len(rows) >= h {
+				return nil, fmt.Errorf("line %d: the cells do not fit into %dx%d", lineno, w, h)
+			}
+			for ; n > 0; n-- {
+				row = append(row, v)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !header {
+		return nil, fmt.Errorf("no RLE header")
+	}
+	if row != nil {
+		rows = append(rows, row)
+	}
+	p := newPatternFromRows(rows, w, h)
+	p.Name = name
+	return p, nil
+}
+
+// parseRLEHeader parses the line "x = m, y = n, rule = ...".  The rule
+// is the rest of the line, it has a comma if the grid is bounded, e.g.
+// "B3/S23:T20,20".
+func parseRLEHeader(line string) (w, h int, err error) {
+	for _, item := range strings.Split(line, ",") {
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			return 0, 0, fmt.Errorf("invalid header item %q", item)
+		}
+		key := strings.TrimSpace(kv[0])
+		value := strings.TrimSpace(kv[1])
+		if key == "rule" {
+			break
+		}
+		switch key {
+		case "x":
+			w, err = strconv.Atoi(value)
+		case "y":
+			h, err = strconv.Atoi(value)
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid header item %q", item)
+		}
+	}
+	if w < 0 || h < 0 || w > maxRLECells || h > maxRLECells || w*h > maxRLECells {
+		return 0, 0, fmt.Errorf("invalid size %dx%d", w, h)
+	}
+	return w, h, nil
+}
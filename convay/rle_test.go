@@ -0,0 +1,72 @@
+package convay
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadRLEGlider(t *testing.T) {
+	text := "#N Glider\n#C a comment\nx = 3, y = 3, rule = B3/S23\nbo$2bo$3o!\n"
+	p, err := ReadRLE(strings.NewReader(text), Old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "Glider" {
+		t.Errorf("invalid name %q", p.Name)
+	}
+	ExpectInt(t, "p.Width", p.Width, 3)
+	ExpectInt(t, "p.Height", p.Height, 3)
+	want := []string{".2.", "..2", "222"}
+	for y, row := range want {
+		for x := 0; x < len(row); x++ {
+			v := Empty
+			if row[x] == '2' {
+				v = Old
+			}
+			ExpectUint64(t, "cell", p.Get(x, y), v)
+		}
+	}
+}
+
+func TestReadRLEMultistate(t *testing.T) {
+	// the run count is split across the lines, the empty rows are
+	// encoded with the count before '$'
+	text := "x = 12, y = 4\n2.A\nB3$\n1\n2o!\nignored"
+	p, err := ReadRLE(strings.NewReader(text), Young)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ExpectInt(t, "p.Width", p.Width, 12)
+	ExpectInt(t, "p.Height", p.Height, 4)
+	ExpectUint64(t, "(2,0)", p.Get(2, 0), Young)
+	ExpectUint64(t, "(3,0)", p.Get(3, 0), Old)
+	ExpectUint64(t, "(0,1)", p.Get(0, 1), Empty)
+	ExpectUint64(t, "(11,3)", p.Get(11, 3), Young)
+	ExpectUint64(t, "(12,3)", p.Get(12, 3), Empty)
+}
+
+func TestReadRLEBoundedRule(t *testing.T) {
+	text := "x = 3, y = 1, rule = B3/S23:T20,20\n3o!\n"
+	p, err := ReadRLE(strings.NewReader(text), Old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ExpectInt(t, "p.Width", p.Width, 3)
+	ExpectUint64(t, "(2,0)", p.Get(2, 0), Old)
+}
+
+func TestReadRLEErrors(t *testing.T) {
+	for _, text := range []string{
+		"",
+		"x = a, y = 3\no!",
+		"x = 3, y = 3\nbzo!",
+		"x = 100000, y = 100000\no!",
+		"x = 2, y = 2\n3o!",
+		"x = 2, y = 2\no2$o!",
+		"x = 2, y = 2\n999999999o!",
+	} {
+		if _, err := ReadRLE(strings.NewReader(text), Old); err == nil {
+			t.Errorf("invalid RLE %q is accepted", text)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package convay
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Rule is the birth/survival rule in the B/S notation, e.g. B3/S23.
+// The counts are the numbers of live (young and old) neighbours.
+//
+// The young/old variant adds the young neighbours constraint, e.g.
+// B3/S23/Y01: a birth or a survival also needs the number of young
+// neighbours to be in the Y set, and a young cell always becomes old.
+// Without the Y part a young cell survives like an old one.
+type Rule struct {
+	Birth   uint16 // bit n is set if n neighbours make a birth
+	Survive uint16 // bit n is set if a cell with n neighbours survives
+	Young   uint16 // bit n is set if n young neighbours are allowed, 0 if not constrained
+	fast    bool   // the default rule, computed without the countPlanes
+	birth   []countMatch
+	survive []countMatch
+	young   []countMatch
+}
+
+// The well known rules.
+var namedRules = map[string]string{
+	"youngold": "B3/S23/Y01",
+	"conway":   "B3/S23",
+	"life":     "B3/S23",
+	"highlife": "B36/S23",
+	"daynight": "B3678/S34678",
+	"seeds":    "B2/S",
+}
+
+const DefaultRule = "B3/S23/Y01"
+
+var defaultRule, _ = ParseRule(DefaultRule)
+
+func NewRule(birth, survive, young uint16) *Rule {
+	r := new(Rule)
+	r.Birth = birth & 0x1ff
+	r.Survive = survive & 0x1ff
+	r.Young = young & 0x1ff
+	r.birth = matches(r.Birth)
+	r.survive = matches(r.Survive)
+	r.young = matches(r.Young)
+	r.fast = r.Birth == 1<<3 && r.Survive == 1<<2|1<<3 && r.Young == 1<<0|1<<1
+	return r
+}
+
+// countMatch has the indices of the countPlanes which are all set when
+// the count is equal to the value.
+type countMatch [4]uint8
+
+func matches(set uint16) []countMatch {
+	var r []countMatch
+	for _, n := range setBits(set) {
+		var m countMatch
+		for b := uint(0); b < 4; b++ {
+			if n&(1<<b) != 0 {
+				m[b] = uint8(b)
+			} else {
+				m[b] = uint8(b + 4)
+			}
+		}
+		r = append(r, m)
+	}
+	return r
+}
+
+func setBits(set uint16) []uint {
+	var r []uint
+	for n := uint(0); n <= 8; n++ {
+		if set&(1<<n) != 0 {
+			r = append(r, n)
+		}
+	}
+	return r
+}
+
+// ParseRule parses the rule name (e.g. highlife) or the rule in the
+// B/S notation with the optional Y part, e.g. B36/S23 or B3/S23/Y01.
+func ParseRule(s string) (*Rule, error) {
+	if named, ok := namedRules[strings.ToLower(s)]; ok {
+		s = named
+	}
+	var birth, survive, young uint16
+	var seen [3]bool
+	for _, part := range strings.Split(s, "/") {
+		if part == "" {
+			return nil, fmt.Errorf("invalid rule %q", s)
+		}
+		var set *uint16
+		var idx int
+		switch part[0] {
+		case 'B', 'b':
+			set, idx = &birth, 0
+		case 'S', 's':
+			set, idx = &survive, 1
+		case 'Y', 'y':
+			set, idx = &young, 2
+		default:
+			return nil, fmt.Errorf("invalid rule %q", s)
+		}
+		if seen[idx] {
+			return nil, fmt.Errorf("invalid rule %q: duplicate %c", s, part[0])
+		}
+		seen[idx] = true
+		for _, c := range part[1:] {
+			if c < '0' || c > '8' {
+				return nil, fmt.Errorf("invalid rule %q: bad count %q", s, c)
+			}
+			*set |= 1 << uint(c-'0')
+		}
+	}
+	if !seen[0] || !seen[1] {
+		return nil, fmt.Errorf("invalid rule %q: needs B and S", s)
+	}
+	if seen[2] && young == 0 {
+		return nil, fmt.Errorf("invalid rule %q: empty Y", s)
+	}
+	return NewRule(birth, survive, young), nil
+}
+
+func (r *Rule) String() string {
+	s := "B" + setString(r.Birth) + "/S" + setString(r.Survive)
+	if r.Young != 0 {
+		s += "/Y" + setString(r.Young)
+	}
+	return s
+}
+
+func setString(set uint16) string {
+	var b []byte
+	for _, n := range setBits(set) {
+		b = append(b, byte('0'+n))
+	}
+	return string(b)
+}
+
+const ones uint64 = 0x1111111111111111
+
+// countPlanes are the bits of the 4-bit counts and their negations,
+// every plane has the lowest bit of every cell.
+type countPlanes [8]uint64
+
+func (p *countPlanes) set(c uint64) {
+	nc := ^c
+	p[0] = c & ones
+	p[1] = (c >> 1) & ones
+	p[2] = (c >> 2) & ones
+	p[3] = (c >> 3) & ones
+	p[4] = nc & ones
+	p[5] = (nc >> 1) & ones
+	p[6] = (nc >> 2) & ones
+	p[7] = (nc >> 3) & ones
+}
+
+// in returns the lowest bits of the cells with the count in the set.
+func (p *countPlanes) in(set []countMatch) uint64 {
+	var r uint64
+	for _, m := range set {
+		r |= p[m[0]] & p[m[1]] & p[m[2]] & p[m[3]]
+	}
+	return r
+}
+
+// next returns the next state of the packed cells orig with the
+// packed neighbour counts.
+func (r *Rule) next(orig uint64, counts cellValue) uint64 {
+	if r.fast {
+		return nextYoungOld(orig, counts)
+	}
+	var total countPlanes
+	total.set(counts.total)
+	birth := total.in(r.birth)
+	survive := total.in(r.survive)
+	youngs := orig & ones
+	olds := (orig >> 2) & ones
+	if r.Young == 0 {
+		// the classic rule, the survivors become old
+		empt := ones &^ (youngs | olds)
+		return (empt & birth) | (((youngs | olds) & survive) << 2)
+	}
+	var young countPlanes
+	young.set(counts.young)
+	allowed := young.in(r.young)
+	// extract all empty cells
+	empt := ones &^ (youngs | olds)
+	// convert them into youngs
+	new1 := empt & birth & allowed
+	// convert all young cells into old
+	new2 := youngs << 2
+	// keep some of the old cells
+	new3 := (olds & survive & allowed) << 2
+	return new1 | new2 | new3
+}
+
+// nextYoungOld is the hand made next for the default rule:
+// 1. each young cell converts to old.
+// 2. an empty cell converts to young cell if Y<2 and T=3, otherwise is empty
+// 3. an old cell remains live if Y<2 and T=[2..3], otherwise is empty
+func nextYoungOld(orig uint64, counts cellValue) uint64 {
+	noto := ^orig
+	notyoung := ^counts.young
+	total := counts.total
+
+	// condition if young less than 2
+	yless2 := (notyoung >> 1) & (notyoung >> 2) & (notyoung >> 3)
+
+	// condition if total is 2 or 3
+	nott := ^total
+	total23 := (total >> 1) & (nott >> 2) & (nott >> 3)
+
+	// extract all young cells and convert them into old
+	new1 := (orig & ones) << 2
+
+	// extract all empty cells
+	empt := noto & (noto >> 2)
+	// convert them into youngs
+	new2 := empt & yless2 & total & total23 & ones
+
+	// extract all old cells
+	olds := orig >> 2
+	// convert them into old
+	new3 := (olds & yless2 & total23 & ones) << 2
+
+	// now combine all three outcomes
+	return new1 | new2 | new3
+}
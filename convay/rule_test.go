@@ -0,0 +1,83 @@
+package convay
+
+import (
+	"testing"
+)
+
+func TestParseRule(t *testing.T) {
+	for _, c := range []struct{ in, out string }{
+		{"B3/S23", "B3/S23"},
+		{"s23/b3", "B3/S23"},
+		{"B3/S23/Y01", "B3/S23/Y01"},
+		{"B3/S23/Y10", "B3/S23/Y01"},
+		{"B2/S", "B2/S"},
+		{"HighLife", "B36/S23"},
+		{"daynight", "B3678/S34678"},
+		{"youngold", DefaultRule},
+	} {
+		r, err := ParseRule(c.in)
+		if err != nil {
+			t.Errorf("%q: %v", c.in, err)
+			continue
+		}
+		if r.String() != c.out {
+			t.Errorf("%q: %q != %q", c.in, r.String(), c.out)
+		}
+	}
+	for _, in := range []string{"", "B3", "S23", "B3/S23/", "B9/S23", "B3/S23/B4", "B3/S23/Y", "X3/S23"} {
+		if _, err := ParseRule(in); err == nil {
+			t.Errorf("invalid rule %q is accepted", in)
+		}
+	}
+}
+
+func TestGridStepRules(t *testing.T) {
+	for _, name := range []string{"conway", "highlife", "daynight", "seeds", "B0/S8", "B35/S0236/Y012"} {
+		r, err := ParseRule(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g := randomGrid(37, 21, 7)
+		g.SetRule(r)
+		for n := 0; n < 8; n++ {
+			want := slowStep(g)
+			g.Step()
+			sameGrid(t, name, g, want)
+		}
+	}
+}
+
+func TestGridStepBlinker(t *testing.T) {
+	r, _ := ParseRule("conway")
+	g := NewGrid(5, 5)
+	g.SetRule(r)
+	g.SetDots(2, 1, "222")
+	g.Step()
+	// the new cells are young, the survivor is old
+	ExpectUint64(t, "(2,1)", g.Get(2, 1), Young)
+	ExpectUint64(t, "(2,2)", g.Get(2, 2), Old)
+	ExpectUint64(t, "(2,3)", g.Get(2, 3), Young)
+	ExpectUint64(t, "(1,2)", g.Get(1, 2), Empty)
+	g.Step()
+	ExpectUint64(t, "(1,2)", g.Get(1, 2), Young)
+	ExpectUint64(t, "(2,2)", g.Get(2, 2), Old)
+	ExpectUint64(t, "(3,2)", g.Get(3, 2), Young)
+	ExpectUint64(t, "(2,1)", g.Get(2, 1), Empty)
+}
+
+func TestRuleFast(t *testing.T) {
+	// the same rule without the fast path
+	r, _ := ParseRule(DefaultRule)
+	if !r.fast {
+		t.Fatal("the default rule is not fast")
+	}
+	r.fast = false
+	g := randomGrid(45, 19, 9)
+	h := randomGrid(45, 19, 9)
+	h.SetRule(r)
+	for n := 0; n < 10; n++ {
+		g.Step()
+		h.Step()
+		sameGrid(t, "fast", g, h)
+	}
+}
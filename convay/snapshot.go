@@ -0,0 +1,114 @@
+package convay
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+)
+
+const snapshotVersion = 1
+
+// Snapshot is the full state of the simulation, including the view of
+// the frontend.  It is saved to the disk with gob.
+type Snapshot struct {
+	Version    int
+	Width      int
+	Height     int
+	Iterations uint64
+	Rule       string     // the rule, the default one if empty
+	Edge       string     // the edge mode, torus if empty
+	Area       [][]uint64 // the packed rows of the grid
+	ViewX0     int        // the index of the top-left cell of the view
+	ViewY0     int
+	CellSize   uint
+}
+
+// Snapshot makes a snapshot of the grid, the view is left empty.
+func (g *Grid) Snapshot() *Snapshot {
+	s := new(Snapshot)
+	s.Version = snapshotVersion
+	s.Width = g.cellsPerRow
+	s.Height = len(g.area)
+	s.Iterations = g.iterations
+	s.Rule = g.rule.String()
+	s.Edge = g.edge.String()
+	s.Area = make([][]uint64, len(g.area))
+	for iy, row := range g.area {
+		s.Area[iy] = append([]uint64(nil), row...)
+	}
+	return s
+}
+
+// Grid makes a new grid out of the snapshot.
+func (s *Snapshot) Grid() (*Grid, error) {
+	if s.Version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", s.Version)
+	}
+	if s.Width <= 0 || s.Height <= 0 || len(s.Area) != s.Height {
+		return nil, fmt.Errorf("invalid snapshot size %dx%d", s.Width, s.Height)
+	}
+	g := NewGrid(s.Width, s.Height)
+	if s.Rule != "" {
+		r, err := ParseRule(s.Rule)
+		if err != nil {
+			return nil, err
+		}
+		g.SetRule(r)
+	}
+	if s.Edge != "" {
+		e, err := ParseEdge(s.Edge)
+		if err != nil {
+			return nil, err
+		}
+		g.SetEdge(e)
+	}
+	for iy, row := range s.Area {
+		if len(row) != len(g.area[iy]) {
+			return nil, fmt.Errorf("invalid snapshot row %d", iy)
+		}
+		copy(g.area[iy], row)
+		g.area[iy][len(row)-1] &= g.lastIntMask
+	}
+	g.iterations = s.Iterations
+	return g, nil
+}
+
+func (s *Snapshot) Write(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(s)
+}
+
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	s := new(Snapshot)
+	if err := gob.NewDecoder(r).Decode(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// SaveSnapshot writes the snapshot into the file.
+func SaveSnapshot(name string, s *Snapshot) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err = s.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadSnapshot reads the snapshot from the file.
+func LoadSnapshot(name string) (*Snapshot, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s, err := ReadSnapshot(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return s, nil
+}
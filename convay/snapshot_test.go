@@ -0,0 +1,64 @@
+package convay
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	g := randomGrid(37, 11, 5)
+	r, _ := ParseRule("highlife")
+	g.SetRule(r)
+	g.SetEdge(EdgeKlein)
+	g.Step()
+	g.Step()
+	s := g.Snapshot()
+	s.ViewX0 = 3
+	s.ViewY0 = 4
+	s.CellSize = 7
+
+	name := filepath.Join(t.TempDir(), "test.snap")
+	if err := SaveSnapshot(name, s); err != nil {
+		t.Fatal(err)
+	}
+	// the snapshot is a copy
+	g.Step()
+
+	s, err := LoadSnapshot(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ExpectInt(t, "s.ViewX0", s.ViewX0, 3)
+	ExpectInt(t, "s.ViewY0", s.ViewY0, 4)
+	ExpectUint(t, "s.CellSize", s.CellSize, 7)
+	h, err := s.Grid()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ExpectUint64(t, "h.Iterations()", h.Iterations(), 2)
+	if h.Rule().String() != "B36/S23" {
+		t.Errorf("invalid rule %s", h.Rule())
+	}
+	if h.Edge() != EdgeKlein {
+		t.Errorf("invalid edge %v", h.Edge())
+	}
+	h.Step()
+	sameGrid(t, "restored", h, g)
+	ExpectUint64(t, "h.Iterations()", h.Iterations(), 3)
+}
+
+func TestSnapshotInvalid(t *testing.T) {
+	s := NewGrid(20, 3).Snapshot()
+	s.Area[1] = s.Area[1][:1]
+	if _, err := s.Grid(); err == nil {
+		t.Error("invalid row is accepted")
+	}
+	s.Area = s.Area[:2]
+	if _, err := s.Grid(); err == nil {
+		t.Error("invalid height is accepted")
+	}
+	if _, err := ReadSnapshot(bytes.NewReader([]byte("garbage"))); err == nil {
+		t.Error("garbage is accepted")
+	}
+}
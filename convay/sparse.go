@@ -0,0 +1,358 @@
+package convay
+
+// Sparse is the unbounded plane of cells.  The plane is stored as a map
+// of fixed size bit-packed tiles, the tiles are created when the
+// activity reaches them, and freed when they become empty.
+type Sparse struct {
+	tiles      map[tileKey]*tile
+	iterations uint64 // the number of steps passed
+	rule       *Rule
+	// the buffers of Step
+	next   map[tileKey]*tile
+	todo   map[tileKey]bool
+	free   []*tile
+	roll   [3][]cellValue
+	counts []cellValue
+}
+
+const tileBits = 6
+const tileSize = 1 << tileBits // the number of cells in the tile side
+const tileMask = tileSize - 1
+const tileInts = tileSize / CellsPerInt
+
+const tileLastOffset = uint((CellsPerInt - 1) * BitsPerCell)
+
+// tileKey is the coordinates of the tile, i.e. of its top-left cell
+// divided by tileSize.
+type tileKey struct {
+	x int
+	y int
+}
+
+type tile [tileSize][tileInts]uint64
+
+var emptyTile tile
+
+func NewSparse() *Sparse {
+	s := new(Sparse)
+	s.tiles = make(map[tileKey]*tile)
+	s.next = make(map[tileKey]*tile)
+	s.todo = make(map[tileKey]bool)
+	for i := range s.roll {
+		s.roll[i] = make([]cellValue, tileInts)
+	}
+	s.counts = make([]cellValue, tileInts)
+	s.rule = defaultRule
+	return s
+}
+
+// Iterations returns the number of steps passed.
+func (s *Sparse) Iterations() uint64 {
+	return s.iterations
+}
+
+// Rule returns the rule of the plane.
+func (s *Sparse) Rule() *Rule {
+	return s.rule
+}
+
+// SetRule changes the rule of the plane.  It panics on the rules with
+// B0: the empty cells away from the tiles would be born too, and only
+// the cells of the tiles are stepped.
+func (s *Sparse) SetRule(r *Rule) {
+	if r.Birth&1 != 0 {
+		panic("Sparse does not support B0 rules")
+	}
+	s.rule = r
+}
+
+// Tiles returns the number of allocated tiles.
+func (s *Sparse) Tiles() int {
+	return len(s.tiles)
+}
+
+func keyOf(x, y int) tileKey {
+	return tileKey{x >> tileBits, y >> tileBits}
+}
+
+func (s *Sparse) newTile() *tile {
+	if n := len(s.free); n > 0 {
+		t := s.free[n-1]
+		s.free = s.free[:n-1]
+		*t = emptyTile
+		return t
+	}
+	return new(tile)
+}
+
+// Get returns the value of the cell.
+func (s *Sparse) Get(x, y int) uint64 {
+	t := s.tiles[keyOf(x, y)]
+	if t == nil {
+		return Empty
+	}
+	lx := x & tileMask
+	shift := uint((lx % CellsPerInt) * BitsPerCell)
+	return (t[y&tileMask][lx/CellsPerInt] >> shift) & CellMask
+}
+
+// Set changes the value of the cell.
+func (s *Sparse) Set(x, y int, v uint64) {
+	k := keyOf(x, y)
+	t := s.tiles[k]
+	if t == nil {
+		if v&CellMask == Empty {
+			return
+		}
+		t = s.newTile()
+		s.tiles[k] = t
+	}
+	lx := x & tileMask
+	ix := lx / CellsPerInt
+	shift := uint((lx % CellsPerInt) * BitsPerCell)
+	row := &t[y&tileMask]
+	row[ix] = row[ix] & ^(CellMask<<shift) | ((v & CellMask) << shift)
+}
+
+// SetDots sets the cells starting from (x,y) to the right.
+// The dots are '0' for empty, '1' for young and '2' for old cells.
+func (s *Sparse) SetDots(y, x int, dots string) {
+	for i := 0; i < len(dots); i++ {
+		var v uint64
+		switch dots[i] {
+		case '1':
+			v = Young
+		case '2':
+			v = Old
+		}
+		s.Set(x+i, y, v)
+	}
+}
+
+// InitConfig puts the named initial configuration around (0,0), see
+// Grid.InitConfig.
+func (s *Sparse) InitConfig(name string) {
+	switch name {
+	case "line":
+		s.SetDots(0, -3, "1222221")
+	case "kaka":
+		s.SetDots(0, 0, "000000012")
+		s.SetDots(1, 0, "2100010021")
+		s.SetDots(2, 0, "0020210021")
+		s.SetDots(3, 0, "222002122")
+		s.SetDots(4, 0, "0110101")
+	case "":
+		// do nothing
+	default:
+		s.SetDots(0, 0, "221")
+		s.SetDots(1, 0, "002")
+		s.SetDots(2, 0, "2")
+	}
+}
+
+// Place copies the pattern into the plane with its top-left corner at
+// (x,y).
+func (s *Sparse) Place(p *Pattern, x, y int) {
+	for py := 0; py < p.Height; py++ {
+		for px := 0; px < p.Width; px++ {
+			s.Set(x+px, y+py, p.Get(px, py))
+		}
+	}
+}
+
+// PlaceCentered places the pattern around (dx,dy).
+func (s *Sparse) PlaceCentered(p *Pattern, dx, dy int) {
+	s.Place(p, dx-p.Width/2, dy-p.Height/2)
+}
+
+// Clean removes all cells.
+func (s *Sparse) Clean() {
+	for k, t := range s.tiles {
+		s.free = append(s.free, t)
+		delete(s.tiles, k)
+	}
+}
+
+// Counts returns the number of young and old cells.
+func (s *Sparse) Counts() (young, old int) {
+	for _, t := range s.tiles {
+		for iy := range t {
+			for _, v := range t[iy] {
+				y, o := countInt(v)
+				young += y
+				old += o
+			}
+		}
+	}
+	return young, old
+}
+
+// Bounds returns the bounding box [x0,x1)x[y0,y1) of the live cells,
+// the empty box if there are none.
+func (s *Sparse) Bounds() (x0, y0, x1, y1 int) {
+	first := true
+	for k, t := range s.tiles {
+		for iy := range t {
+			for ix, v := range t[iy] {
+				for i := 0; v != 0; i, v = i+1, v>>BitsPerCell {
+					if v&CellMask == Empty {
+						continue
+					}
+					x := k.x<<tileBits + ix*CellsPerInt + i
+					y := k.y<<tileBits + iy
+					if first || x < x0 {
+						x0 = x
+					}
+					if first || x >= x1 {
+						x1 = x + 1
+					}
+					if first || y < y0 {
+						y0 = y
+					}
+					if first || y >= y1 {
+						y1 = y + 1
+					}
+					first = false
+				}
+			}
+		}
+	}
+	return x0, y0, x1, y1
+}
+
+// word returns the packed CellsPerInt cells starting from (x,y).
+func (s *Sparse) word(x, y int) uint64 {
+	ax := x &^ (CellsPerInt - 1)
+	lo := s.alignedWord(ax, y)
+	off := uint(x-ax) * BitsPerCell
+	if off == 0 {
+		return lo
+	}
+	return lo>>off | s.alignedWord(ax+CellsPerInt, y)<<(64-off)
+}
+
+func (s *Sparse) alignedWord(x, y int) uint64 {
+	t := s.tiles[keyOf(x, y)]
+	if t == nil {
+		return 0
+	}
+	return t[y&tileMask][(x&tileMask)/CellsPerInt]
+}
+
+// ReadRow packs the cells of the row y starting from x0 into dst.
+func (s *Sparse) ReadRow(dst []uint64, x0, y int) {
+	for i := range dst {
+		dst[i] = s.word(x0+i*CellsPerInt, y)
+	}
+}
+
+// The directions of the neighbour tiles.
+var tileNeighbours = [8]tileKey{
+	{-1, -1}, {0, -1}, {1, -1},
+	{-1, 0}, {1, 0},
+	{-1, 1}, {0, 1}, {1, 1},
+}
+
+// borders returns which neighbour tiles (in the order of
+// tileNeighbours) are touched by the live cells of the tile.
+func (t *tile) borders() (r [8]bool) {
+	const first = CellMask
+	const last = CellMask << tileLastOffset
+	var left, right uint64
+	for iy := range t {
+		left |= t[iy][0] & first
+		right |= t[iy][tileInts-1] & last
+	}
+	var top, bottom uint64
+	for ix := 0; ix < tileInts; ix++ {
+		top |= t[0][ix]
+		bottom |= t[tileSize-1][ix]
+	}
+	r[0] = t[0][0]&first != 0
+	r[1] = top != 0
+	r[2] = t[0][tileInts-1]&last != 0
+	r[3] = left != 0
+	r[4] = right != 0
+	r[5] = t[tileSize-1][0]&first != 0
+	r[6] = bottom != 0
+	r[7] = t[tileSize-1][tileInts-1]&last != 0
+	return r
+}
+
+// Step makes one generation.
+func (s *Sparse) Step() {
+	// the tiles to compute are the live ones and their touched neighbours
+	for k, t := range s.tiles {
+		s.todo[k] = true
+		for i, touched := range t.borders() {
+			if touched {
+				n := tileNeighbours[i]
+				s.todo[tileKey{k.x + n.x, k.y + n.y}] = true
+			}
+		}
+	}
+	for k := range s.todo {
+		t := s.newTile()
+		if s.stepTile(k, t) {
+			s.next[k] = t
+		} else {
+			s.free = append(s.free, t)
+		}
+		delete(s.todo, k)
+	}
+	s.Clean()
+	s.tiles, s.next = s.next, s.tiles
+	s.iterations++
+}
+
+// tileRow returns the row iy (-1..tileSize) of the tile k, with the
+// values of the cells to the left and to the right of it.
+func (s *Sparse) tileRow(k tileKey, iy int) (row []uint64, left, right uint64) {
+	if iy < 0 {
+		k.y--
+		iy += tileSize
+	} else if iy >= tileSize {
+		k.y++
+		iy -= tileSize
+	}
+	row = emptyTile[0][:]
+	if t := s.tiles[k]; t != nil {
+		row = t[iy][:]
+	}
+	if t := s.tiles[tileKey{k.x - 1, k.y}]; t != nil {
+		left = (t[iy][tileInts-1] >> tileLastOffset) & CellMask
+	}
+	if t := s.tiles[tileKey{k.x + 1, k.y}]; t != nil {
+		right = t[iy][0] & CellMask
+	}
+	return row, left, right
+}
+
+// stepTile makes the next state of the tile k into next, and tells if
+// the next state has live cells.
+func (s *Sparse) stepTile(k tileKey, next *tile) bool {
+	const lim = ^uint64(0)
+	orig := s.tiles[k]
+	if orig == nil {
+		orig = &emptyTile
+	}
+	roll := &s.roll
+	row, left, right := s.tileRow(k, -1)
+	tripleRow(roll[1], row, tileLastOffset, lim, left, right)
+	row, left, right = s.tileRow(k, 0)
+	tripleRow(roll[2], row, tileLastOffset, lim, left, right)
+	var live uint64
+	for iy := 0; iy < tileSize; iy++ {
+		// shift all rows, the oldest one is reused for the next row
+		roll[0], roll[1], roll[2] = roll[1], roll[2], roll[0]
+		row, left, right = s.tileRow(k, iy+1)
+		tripleRow(roll[2], row, tileLastOffset, lim, left, right)
+		sumup8(s.counts, roll, orig[iy][:])
+		for ix := 0; ix < tileInts; ix++ {
+			v := s.rule.next(orig[iy][ix], s.counts[ix])
+			next[iy][ix] = v
+			live |= v
+		}
+	}
+	return live != 0
+}
@@ -0,0 +1,152 @@
+package convay
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestSparseGetSet(t *testing.T) {
+	s := NewSparse()
+	s.Set(-1, -1, Young)
+	s.Set(64, 0, Old)
+	s.Set(100, 100, Empty) // does not make a tile
+	ExpectUint64(t, "(-1,-1)", s.Get(-1, -1), Young)
+	ExpectUint64(t, "(64,0)", s.Get(64, 0), Old)
+	ExpectUint64(t, "(63,0)", s.Get(63, 0), Empty)
+	ExpectInt(t, "s.Tiles()", s.Tiles(), 2)
+	young, old := s.Counts()
+	ExpectInt(t, "young", young, 1)
+	ExpectInt(t, "old", old, 1)
+	x0, y0, x1, y1 := s.Bounds()
+	ExpectInt(t, "x0", x0, -1)
+	ExpectInt(t, "y0", y0, -1)
+	ExpectInt(t, "x1", x1, 65)
+	ExpectInt(t, "y1", y1, 1)
+	dst := make([]uint64, 2)
+	s.ReadRow(dst, -2, -1)
+	ExpectUint64(t, "ReadRow", dst[0], Young<<4)
+	s.ReadRow(dst, 50, 0)
+	ExpectUint64(t, "ReadRow", dst[0], Old<<((64-50)*4))
+	s.Clean()
+	ExpectInt(t, "s.Tiles()", s.Tiles(), 0)
+}
+
+// TestSparseStep compares the sparse plane with the dead edge grid, the
+// 40x40 soup in the middle of the 300x300 grid does not reach its edges
+// in 60 steps.
+func TestSparseStep(t *testing.T) {
+	for _, rule := range []string{DefaultRule, "conway", "highlife"} {
+		r, _ := ParseRule(rule)
+		g := NewGrid(300, 300)
+		g.SetRule(r)
+		g.SetEdge(EdgeDead)
+		s := NewSparse()
+		s.SetRule(r)
+		rnd := rand.New(rand.NewSource(17))
+		// the soup crosses the tile borders
+		for y := -20; y < 20; y++ {
+			for x := -20; x < 20; x++ {
+				v := Empty
+				switch rnd.Intn(4) {
+				case 0:
+					v = Young
+				case 1:
+					v = Old
+				}
+				g.Set(150+x, 150+y, v)
+				s.Set(x, y, v)
+			}
+		}
+		for n := 0; n < 60; n++ {
+			g.Step()
+			s.Step()
+		}
+		for y := 0; y < 300; y++ {
+			for x := 0; x < 300; x++ {
+				if g.Get(x, y) != s.Get(x-150, y-150) {
+					t.Fatalf("%s: (%d,%d) %x != %x", rule, x-150, y-150,
+						s.Get(x-150, y-150), g.Get(x, y))
+				}
+			}
+		}
+		gy, go_ := g.Counts()
+		sy, so := s.Counts()
+		ExpectInt(t, "young", sy, gy)
+		ExpectInt(t, "old", so, go_)
+		ExpectUint64(t, "iterations", s.Iterations(), 60)
+	}
+}
+
+func TestSparseRuleB0(t *testing.T) {
+	r, _ := ParseRule("B0/S8")
+	defer func() {
+		if recover() == nil {
+			t.Error("B0 rule is accepted")
+		}
+	}()
+	NewSparse().SetRule(r)
+}
+
+func TestSparseGlider(t *testing.T) {
+	// the glider flies away and the tiles follow it
+	r, _ := ParseRule("conway")
+	s := NewSparse()
+	s.SetRule(r)
+	s.InitConfig("glider")
+	for n := 0; n < 1000; n++ {
+		s.Step()
+	}
+	young, old := s.Counts()
+	ExpectInt(t, "cells", young+old, 5)
+	if s.Tiles() > 4 {
+		t.Errorf("too many tiles: %d", s.Tiles())
+	}
+	x0, y0, x1, y1 := s.Bounds()
+	ExpectInt(t, "width", x1-x0, 3)
+	ExpectInt(t, "height", y1-y0, 3)
+	ExpectInt(t, "distance", x0, 250)
+}
+
+func TestGridReadRow(t *testing.T) {
+	g := randomGrid(37, 3, 19)
+	dst := make([]uint64, 4)
+	for _, x0 := range []int{0, 3, 16, 21, 30, -5} {
+		g.ReadRow(dst, x0, 4)
+		for i := 0; i < len(dst)*CellsPerInt; i++ {
+			v := (dst[i/CellsPerInt] >> uint((i%CellsPerInt)*BitsPerCell)) & CellMask
+			ExpectUint64(t, "ReadRow", v, g.Get(x0+i, 1))
+		}
+	}
+}
+
+func BenchmarkSparseStep(b *testing.B) {
+	s := NewSparse()
+	rnd := rand.New(rand.NewSource(1))
+	for y := 0; y < 400; y++ {
+		for x := 0; x < 400; x++ {
+			if rnd.Intn(3) == 0 {
+				s.Set(x, y, Old)
+			}
+		}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Step()
+	}
+}
+
+func TestSparseWriteCells(t *testing.T) {
+	s := NewSparse()
+	s.SetDots(-1, -2, "12")
+	s.SetDots(0, -2, "02")
+	var buf bytes.Buffer
+	if err := s.WriteCells(&buf, ""); err != nil {
+		t.Fatal(err)
+	}
+	want := "!Generation: 0\n!Origin: -2,-1\noO\n.O\n"
+	if buf.String() != want {
+		t.Errorf("invalid output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,203 @@
+package convay
+
+import (
+	"sync"
+)
+
+type cellValue struct {
+	young uint64
+	total uint64
+}
+
+// band is the rows processed by one goroutine in Step,
+// with the scratch rows to make the running sums.
+type band struct {
+	g      *Grid
+	y0     int
+	y1     int
+	roll   [3][]cellValue // the running sums of the previous, this and next rows
+	counts []cellValue
+}
+
+// stepper has all buffers of Step, so the stepping makes no garbage.
+type stepper struct {
+	next   [][]uint64 // the next state of the area
+	top    []cellValue
+	bottom []cellValue
+	rev    []uint64 // the reversed row for the Klein bottle edge
+	bands  []band
+	wg     sync.WaitGroup
+}
+
+// The bands are processed by the goroutines which are started once and
+// shared by all grids.
+var (
+	bandQueue      = make(chan *band)
+	bandWorkers    int
+	bandWorkersMux sync.Mutex
+)
+
+func startBandWorkers(n int) {
+	bandWorkersMux.Lock()
+	defer bandWorkersMux.Unlock()
+	for ; bandWorkers < n; bandWorkers++ {
+		go func() {
+			for b := range bandQueue {
+				b.g.stepBand(b)
+				b.g.stepper.wg.Done()
+			}
+		}()
+	}
+}
+
+// prepare (re)allocates the buffers of Step if the grid has changed.
+func (g *Grid) prepare() {
+	nrows := len(g.area)
+	nint := len(g.area[0])
+	nbands := g.bands()
+	st := &g.stepper
+	if len(st.next) == nrows && len(st.top) == nint && len(st.bands) == nbands {
+		return
+	}
+	st.next = make([][]uint64, nrows)
+	for iy := range st.next {
+		st.next[iy] = make([]uint64, nint)
+	}
+	st.top = make([]cellValue, nint)
+	st.bottom = make([]cellValue, nint)
+	st.rev = make([]uint64, nint)
+	st.bands = make([]band, nbands)
+	for i := range st.bands {
+		b := &st.bands[i]
+		b.g = g
+		b.y0 = nrows * i / nbands
+		b.y1 = nrows * (i + 1) / nbands
+		for j := range b.roll {
+			b.roll[j] = make([]cellValue, nint)
+		}
+		b.counts = make([]cellValue, nint)
+	}
+	if nbands > 1 {
+		startBandWorkers(nbands)
+	}
+}
+
+//     01 01 01 01 prev
+//     >> 01 01 01 01 prev+   -> 11 11 11 11
+//  01 01 01 01 << prev-
+//
+//     01 01 01 01 this - ignored
+//     >> 01 01 01 01 this+   -> 10 10 10 10
+//  01 01 01 01 << this-
+//
+//     01 01 01 01 next       -> 11 11 11 11
+//     >> 01 01 01 01 next+
+//  01 01 01 01 << next-
+
+func cellSplit(x uint64) cellValue {
+	const lowMask uint64 = 0x3333333333333333
+	y := x & lowMask
+	return cellValue{y, (x>>2)&lowMask + y}
+}
+
+// Makes a running sum of the row into the result, the array of
+// (young,total).  The left and right are the values of the virtual
+// cells before the first and after the last cell of the row.
+func tripleRow(result []cellValue, orig []uint64, lco uint, lim uint64, left, right uint64) {
+	nint := len(orig)
+	ls := uint(BitsPerCell)
+	rs := uint(64 - BitsPerCell)
+	for i := 1; i < nint-1; i++ {
+		o := orig[i]
+		a := orig[i-1]
+		b := orig[i+1]
+		x := o + (o >> ls) + (b << rs) + (o << ls) + (a >> rs)
+		result[i] = cellSplit(x)
+	}
+	if nint > 1 {
+		o := orig[0]
+		b := orig[1]
+		x := o + (o >> ls) + (b << rs) + (o << ls) + left
+		result[0] = cellSplit(x)
+		o = orig[nint-1]
+		a := orig[nint-2]
+		x = o + (o >> ls) + (right << lco) + (o << ls) + (a >> rs)
+		x &= lim
+		result[nint-1] = cellSplit(x)
+	} else {
+		o := orig[0]
+		x := o + (o >> ls) + (right << lco) + (o << ls) + left
+		x &= lim
+		result[0] = cellSplit(x)
+	}
+}
+
+// Sumup 8 adjacent cells together into the res.
+// Simple trick is to sumup all 9 cells, then subtrack the central one.
+// Thus we can reuse the running sums of the rows.
+func sumup8(res []cellValue, arg *[3][]cellValue, orig []uint64) {
+	nint := len(orig)
+	a := arg[0][:nint]
+	b := arg[1][:nint]
+	c := arg[2][:nint]
+	res = res[:nint]
+	for i := 0; i < nint; i++ {
+		v := cellSplit(orig[i])
+		res[i].young = a[i].young + b[i].young + c[i].young - v.young
+		res[i].total = a[i].total + b[i].total + c[i].total - v.total
+	}
+}
+
+// Step makes one generation.
+// The rows are split into bands, which are processed concurrently.
+// The next state is made in the second buffer, so Step does not
+// allocate once the buffers are made.
+func (g *Grid) Step() {
+	g.prepare()
+	st := &g.stepper
+	g.halos(st.top, st.bottom)
+	if len(st.bands) == 1 {
+		g.stepBand(&st.bands[0])
+	} else {
+		st.wg.Add(len(st.bands))
+		for i := range st.bands {
+			bandQueue <- &st.bands[i]
+		}
+		st.wg.Wait()
+	}
+	g.area, st.next = st.next, g.area
+	g.iterations++
+}
+
+// stepBand makes the next state of the rows of the band.
+func (g *Grid) stepBand(b *band) {
+	nrows := len(g.area)
+	next := g.stepper.next
+	roll := &b.roll // working area
+	if b.y0 > 0 {
+		g.triple(roll[1], g.area[b.y0-1])
+	} else {
+		copy(roll[1], g.stepper.top)
+	}
+	g.triple(roll[2], g.area[b.y0])
+	for iy := b.y0; iy < b.y1; iy++ {
+		// shift all rows, the oldest one is reused for the next row
+		roll[0], roll[1], roll[2] = roll[1], roll[2], roll[0]
+		// fill the next row
+		idx := iy + 1
+		if idx < nrows {
+			g.triple(roll[2], g.area[idx])
+		} else {
+			copy(roll[2], g.stepper.bottom)
+		}
+		// now sumup all young and total number of adjacent cells.
+		// counts is an array of number of Y (young) and T(total) cells around.
+		sumup8(b.counts, roll, g.area[iy])
+		row := g.area[iy]
+		nrow := next[iy]
+		for ix := range row {
+			nrow[ix] = g.rule.next(row[ix], b.counts[ix])
+		}
+		nrow[len(nrow)-1] &= g.lastIntMask
+	}
+}
@@ -0,0 +1,85 @@
+package convay
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestGridStepParallel(t *testing.T) {
+	saved := minBandRows
+	defer func() { minBandRows = saved }()
+	minBandRows = 1
+	for _, e := range []Edge{EdgeTorus, EdgeDead, EdgeMirror, EdgeKlein} {
+		for _, workers := range []int{2, 3, 7, 50} {
+			g := randomGrid(70, 23, 13)
+			g.SetEdge(e)
+			h := randomGrid(70, 23, 13)
+			h.SetEdge(e)
+			h.SetWorkers(1)
+			g.SetWorkers(workers)
+			for n := 0; n < 10; n++ {
+				g.Step()
+				h.Step()
+				sameGrid(t, "parallel", g, h)
+			}
+		}
+	}
+}
+
+func TestGridStepNoAllocs(t *testing.T) {
+	saved := minBandRows
+	defer func() { minBandRows = saved }()
+	minBandRows = 1
+	for _, e := range []Edge{EdgeTorus, EdgeDead, EdgeKlein} {
+		for _, workers := range []int{1, 4} {
+			g := randomGrid(100, 40, 1)
+			g.SetEdge(e)
+			g.SetWorkers(workers)
+			// the runtime fills its caches of the parked goroutines at
+			// the first steps of the bands, and starts its own goroutines
+			// at the first collection, they are counted as the allocations
+			for i := 0; i < 200; i++ {
+				g.Step()
+			}
+			runtime.GC()
+			allocs := testing.AllocsPerRun(20, g.Step)
+			if allocs != 0 {
+				t.Errorf("%v %d workers: %.1f allocs per step", e, workers, allocs)
+			}
+		}
+	}
+}
+
+func TestGridStepBuffers(t *testing.T) {
+	// the buffers follow the changes of the grid
+	g := randomGrid(30, 20, 2)
+	g.Step()
+	g.Init(50, 10)
+	g.InitConfig("kaka")
+	want := slowStep(g)
+	g.Step()
+	sameGrid(t, "reinit", g, want)
+}
+
+func benchmarkGridStep(b *testing.B, nx, ny, workers int) {
+	g := randomGrid(nx, ny, 1)
+	g.SetWorkers(workers)
+	g.Step() // make the buffers
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		g.Step()
+	}
+}
+
+func BenchmarkGridStep(b *testing.B) {
+	benchmarkGridStep(b, 400, 400, 1)
+}
+
+func BenchmarkGridStep4000(b *testing.B) {
+	benchmarkGridStep(b, 4000, 4000, 1)
+}
+
+func BenchmarkGridStep4000Parallel(b *testing.B) {
+	benchmarkGridStep(b, 4000, 4000, 0)
+}
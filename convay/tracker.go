@@ -0,0 +1,67 @@
+package convay
+
+// Tracker keeps the bookkeeping of the generations of the universe for
+// the interactive tools: the states to undo, the cycle detection and the
+// population history.  The cells are changed either by Step, or between
+// Edit and Touch.
+type Tracker struct {
+	Undo    *Undo
+	Cycle   *Cycle
+	History *History
+}
+
+func NewTracker(undoSize, cycleWindow, historySize int) *Tracker {
+	t := new(Tracker)
+	t.Undo = NewUndo(undoSize)
+	t.Cycle = NewCycle(cycleWindow)
+	t.History = NewHistory(historySize)
+	return t
+}
+
+// Edit saves the state of u for the undo before its cells are changed.
+func (t *Tracker) Edit(u Universe) {
+	t.Undo.Save(u)
+}
+
+// Touch restarts the cycle detection after the cells of u are changed
+// not by a step.
+func (t *Tracker) Touch(u Universe) {
+	s := Census(u)
+	t.Cycle.Reset()
+	t.Cycle.Observe(u, s)
+	t.History.Add(s)
+}
+
+// Step makes the next generation of u and tells if the cycle is found.
+// The census of the generation is shared by the history and the cycle.
+func (t *Tracker) Step(u Universe) bool {
+	t.Undo.SaveStep(u)
+	u.Step()
+	s := Census(u)
+	t.History.Add(s)
+	return t.Cycle.Observe(u, s)
+}
+
+// Revert restores the previous state of u, the previous generation if
+// back is set, and tells if there was one.
+func (t *Tracker) Revert(u Universe, back bool) bool {
+	var ok bool
+	if back {
+		ok = t.Undo.StepBack(u)
+	} else {
+		ok = t.Undo.Undo(u)
+	}
+	if ok {
+		t.Touch(u)
+	}
+	return ok
+}
+
+// Redo restores the last reverted state of u and tells if there was one.
+func (t *Tracker) Redo(u Universe) bool {
+	if !t.Undo.Redo(u) {
+		return false
+	}
+	t.Touch(u)
+	return true
+}
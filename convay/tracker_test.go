@@ -0,0 +1,47 @@
+package convay
+
+import (
+	"testing"
+)
+
+func TestTracker(t *testing.T) {
+	tr := NewTracker(10, 10, 10)
+	r, _ := ParseRule("conway")
+	g := NewGrid(10, 10)
+	g.SetRule(r)
+	// the blinker
+	g.SetDots(5, 4, "222")
+	tr.Touch(g)
+	h := g.Hash()
+	for !tr.Step(g) {
+	}
+	n := g.Iterations()
+	ExpectInt(t, "Period", tr.Cycle.Period, 2)
+	ExpectInt(t, "History.Len", tr.History.Len(), int(n)+1)
+	ExpectInt(t, "Total", tr.History.Last().Total(), 3)
+
+	// the edit restarts the cycle detection
+	tr.Edit(g)
+	g.Set(0, 0, Old)
+	tr.Touch(g)
+	ExpectInt(t, "Period", tr.Cycle.Period, 0)
+	ExpectInt(t, "Total", tr.History.Last().Total(), 4)
+
+	if !tr.Revert(g, false) {
+		t.Fatal("no edit to revert")
+	}
+	ExpectUint64(t, "Get", g.Get(0, 0), Empty)
+	ExpectInt(t, "Total", tr.History.Last().Total(), 3)
+	if !tr.Revert(g, true) {
+		t.Fatal("no step to revert")
+	}
+	ExpectUint64(t, "Iterations", g.Iterations(), n-1)
+	if !tr.Redo(g) {
+		t.Fatal("no step to redo")
+	}
+	ExpectUint64(t, "Iterations", g.Iterations(), n)
+	for tr.Revert(g, true) {
+	}
+	ExpectUint64(t, "Iterations", g.Iterations(), 0)
+	ExpectUint64(t, "Hash", g.Hash(), h)
+}
@@ -0,0 +1,288 @@
+package convay
+
+// Undo is the bounded history of the previous states of the universe
+// for the undo, the redo and the step back.  The states are the full
+// copies, bounded by their number and by their memory, the evicted ones
+// are reused.  The steps of a run are saved every CheckpointSteps
+// generations only, the step back makes the generations between them
+// again.
+type Undo struct {
+	size     int
+	maxBytes int        // the memory of the states kept
+	past     []Universe // the oldest state first
+	steps    []bool     // the states of the past saved before a step
+	future   []Universe // the states undone, the latest undone last
+	free     []Universe
+}
+
+// CheckpointSteps is the number of the generations between the states
+// saved by SaveStep.
+const CheckpointSteps = 16
+
+// DefaultUndoBytes is the default memory of the states kept.
+const DefaultUndoBytes = 256 << 20
+
+// maxFree is the number of the evicted states kept for the reuse.
+const maxFree = 2
+
+func NewUndo(size int) *Undo {
+	h := new(Undo)
+	h.size = size
+	h.maxBytes = DefaultUndoBytes
+	return h
+}
+
+// SetMaxBytes changes the memory of the states kept, at least one state
+// is kept anyway.
+func (h *Undo) SetMaxBytes(n int) {
+	h.maxBytes = n
+	h.evict()
+}
+
+// stateBytes returns the memory of the state.
+func stateBytes(u Universe) int {
+	switch s := u.(type) {
+	case *Grid:
+		if len(s.area) == 0 {
+			return 0
+		}
+		return len(s.area) * len(s.area[0]) * 8
+	case *Sparse:
+		return (len(s.tiles) + len(s.free)) * tileSize * tileInts * 8
+	}
+	return 0
+}
+
+// Clone returns the copy of the grid.
+func (g *Grid) Clone() *Grid {
+	c := new(Grid)
+	c.CopyFrom(g)
+	return c
+}
+
+// CopyFrom makes the grid the copy of src, the buffers of the grid are
+// reused if the size is the same.
+func (g *Grid) CopyFrom(src *Grid) {
+	if g.cellsPerRow != src.cellsPerRow || len(g.area) != len(src.area) {
+		g.Init(src.cellsPerRow, len(src.area))
+	}
+	for iy, row := range src.area {
+		copy(g.area[iy], row)
+	}
+	g.iterations = src.iterations
+	g.rule = src.rule
+	g.edge = src.edge
+}
+
+// Clone returns the copy of the plane.
+func (s *Sparse) Clone() *Sparse {
+	c := NewSparse()
+	c.CopyFrom(s)
+	return c
+}
+
+// CopyFrom makes the plane the copy of src.
+func (s *Sparse) CopyFrom(src *Sparse) {
+	s.Clean()
+	for k, t := range src.tiles {
+		c := s.newTile()
+		*c = *t
+		s.tiles[k] = c
+	}
+	s.iterations = src.iterations
+	s.rule = src.rule
+}
+
+// copyUniverse makes dst the copy of src, both must be of the same type.
+func copyUniverse(dst, src Universe) {
+	switch d := dst.(type) {
+	case *Grid:
+		d.CopyFrom(src.(*Grid))
+	case *Sparse:
+		d.CopyFrom(src.(*Sparse))
+	default:
+		panic("unknown universe")
+	}
+}
+
+// release keeps the state for the reuse if there are few.
+func (h *Undo) release(u Universe) {
+	if len(h.free) < maxFree {
+		h.free = append(h.free, u)
+	}
+}
+
+// clone returns the copy of u, reusing the free states.
+func (h *Undo) clone(u Universe) Universe {
+	for i, c := range h.free {
+		if sameType(c, u) {
+			h.free = append(h.free[:i], h.free[i+1:]...)
+			copyUniverse(c, u)
+			return c
+		}
+	}
+	switch s := u.(type) {
+	case *Grid:
+		return s.Clone()
+	case *Sparse:
+		return s.Clone()
+	}
+	panic("unknown universe")
+}
+
+func sameType(a, b Universe) bool {
+	_, ga := a.(*Grid)
+	_, gb := b.(*Grid)
+	return ga == gb
+}
+
+// Reset forgets all states, e.g. when the universe is replaced by the
+// one of the other type.
+func (h *Undo) Reset() {
+	h.past = nil
+	h.steps = nil
+	h.future = nil
+	h.free = nil
+}
+
+// Undos returns the number of the states which can be undone.
+func (h *Undo) Undos() int {
+	return len(h.past)
+}
+
+// Redos returns the number of the states which can be redone.
+func (h *Undo) Redos() int {
+	return len(h.future)
+}
+
+// Save records the state of the universe before it is changed by an
+// edit, the undone states are forgotten.
+func (h *Undo) Save(u Universe) {
+	h.save(u, false)
+}
+
+// SaveStep records the state of the universe before it is stepped, only
+// every CheckpointSteps generations and after the edits.  The undone
+// states are forgotten.
+func (h *Undo) SaveStep(u Universe) {
+	if n := len(h.past); n > 0 && h.steps[n-1] &&
+		u.Iterations() > h.past[n-1].Iterations() &&
+		u.Iterations()-h.past[n-1].Iterations() < CheckpointSteps {
+		h.forgetFuture()
+		return
+	}
+	h.save(u, true)
+}
+
+func (h *Undo) forgetFuture() {
+	for _, f := range h.future {
+		h.release(f)
+	}
+	h.future = h.future[:0]
+}
+
+func (h *Undo) save(u Universe, step bool) {
+	h.forgetFuture()
+	if h.size <= 0 {
+		return
+	}
+	if len(h.past) >= h.size {
+		h.dropOldest()
+	}
+	h.push(h.clone(u), step)
+	h.evict()
+}
+
+func (h *Undo) push(u Universe, step bool) {
+	h.past = append(h.past, u)
+	h.steps = append(h.steps, step)
+}
+
+func (h *Undo) pop() Universe {
+	n := len(h.past)
+	u := h.past[n-1]
+	h.past = h.past[:n-1]
+	h.steps = h.steps[:n-1]
+	return u
+}
+
+func (h *Undo) dropOldest() {
+	h.release(h.past[0])
+	copy(h.past, h.past[1:])
+	copy(h.steps, h.steps[1:])
+	h.past = h.past[:len(h.past)-1]
+	h.steps = h.steps[:len(h.steps)-1]
+}
+
+// evict drops the oldest states beyond the memory, the latest one is
+// kept.
+func (h *Undo) evict() {
+	total := 0
+	for _, u := range h.past {
+		total += stateBytes(u)
+	}
+	for _, u := range h.future {
+		total += stateBytes(u)
+	}
+	for total > h.maxBytes && len(h.past) > 1 {
+		total -= stateBytes(h.past[0])
+		h.dropOldest()
+	}
+}
+
+// Undo restores the previous state of the universe and tells if there
+// was one.
+func (h *Undo) Undo(u Universe) bool {
+	n := len(h.past)
+	if n == 0 {
+		return false
+	}
+	h.future = append(h.future, h.clone(u))
+	prev := h.pop()
+	copyUniverse(u, prev)
+	h.release(prev)
+	return true
+}
+
+// Redo restores the last undone state of the universe and tells if
+// there was one.
+func (h *Undo) Redo(u Universe) bool {
+	n := len(h.future)
+	if n == 0 {
+		return false
+	}
+	h.push(h.clone(u), false)
+	copyUniverse(u, h.future[n-1])
+	h.release(h.future[n-1])
+	h.future = h.future[:n-1]
+	return true
+}
+
+// StepBack restores the latest saved state of an earlier generation,
+// the later states including the edits can be redone.  The generation
+// after the latest checkpoint of a run is made again from it.  It tells
+// if there was such a state.
+func (h *Undo) StepBack(u Universe) bool {
+	gen := u.Iterations()
+	i := len(h.past) - 1
+	for i >= 0 && h.past[i].Iterations() >= gen {
+		i--
+	}
+	if i < 0 {
+		return false
+	}
+	for len(h.past) > i+1 {
+		h.Undo(u)
+	}
+	if h.steps[i] && h.past[i].Iterations()+1 < gen {
+		// there were only the steps since the checkpoint, it is kept
+		h.future = append(h.future, h.clone(u))
+		copyUniverse(u, h.past[i])
+		for u.Iterations() < gen-1 {
+			u.Step()
+		}
+		return true
+	}
+	h.Undo(u)
+	return true
+}
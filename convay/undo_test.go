@@ -0,0 +1,129 @@
+package convay
+
+import (
+	"testing"
+)
+
+func TestUndoSteps(t *testing.T) {
+	g := randomGrid(40, 30, 1)
+	orig := g.Clone()
+	h := NewUndo(10)
+	for i := 0; i < 3; i++ {
+		h.Save(g)
+		g.Step()
+	}
+	after := g.Clone()
+	ExpectInt(t, "Undos", h.Undos(), 3)
+	for i := 0; i < 3; i++ {
+		if !h.Undo(g) {
+			t.Fatal("nothing to undo")
+		}
+	}
+	if h.Undo(g) {
+		t.Error("undo past the first state")
+	}
+	sameGrid(t, "undo", g, orig)
+	ExpectUint64(t, "Iterations", g.Iterations(), 0)
+	ExpectInt(t, "Redos", h.Redos(), 3)
+	for h.Redo(g) {
+	}
+	sameGrid(t, "redo", g, after)
+	ExpectUint64(t, "Iterations", g.Iterations(), 3)
+	// a new change forgets the undone states
+	h.Undo(g)
+	h.Save(g)
+	g.Set(0, 0, Old)
+	ExpectInt(t, "Redos", h.Redos(), 0)
+}
+
+func TestUndoSize(t *testing.T) {
+	s := NewSparse()
+	h := NewUndo(2)
+	for i := 0; i < 5; i++ {
+		h.Save(s)
+		s.Set(i, 0, Old)
+	}
+	ExpectInt(t, "Undos", h.Undos(), 2)
+	h.Undo(s)
+	h.Undo(s)
+	young, old := s.Counts()
+	ExpectInt(t, "young", young, 0)
+	ExpectInt(t, "old", old, 3)
+}
+
+func TestUndoStepBack(t *testing.T) {
+	g := randomGrid(20, 20, 2)
+	h := NewUndo(10)
+	h.Save(g)
+	g.Step()
+	gen1 := g.Clone()
+	h.Save(g)
+	g.Step()
+	// the edits of the generation 2
+	h.Save(g)
+	g.Set(1, 1, Old)
+	h.Save(g)
+	g.Set(2, 1, Old)
+	if !h.StepBack(g) {
+		t.Fatal("no step back")
+	}
+	sameGrid(t, "step back", g, gen1)
+	ExpectUint64(t, "Iterations", g.Iterations(), 1)
+	ExpectInt(t, "Redos", h.Redos(), 3)
+	h.StepBack(g)
+	ExpectUint64(t, "Iterations", g.Iterations(), 0)
+	if h.StepBack(g) {
+		t.Error("step back before the first state")
+	}
+}
+
+func TestUndoCheckpoints(t *testing.T) {
+	g := randomGrid(30, 30, 3)
+	h := NewUndo(10)
+	var gens []*Grid
+	for i := 0; i < 40; i++ {
+		gens = append(gens, g.Clone())
+		h.SaveStep(g)
+		g.Step()
+	}
+	// the generations 0, 16 and 32
+	ExpectInt(t, "Undos", h.Undos(), 3)
+	for i := 39; i >= 0; i-- {
+		if !h.StepBack(g) {
+			t.Fatalf("no step back to %d", i)
+		}
+		sameGrid(t, "step back", g, gens[i])
+		ExpectUint64(t, "Iterations", g.Iterations(), uint64(i))
+	}
+	if h.StepBack(g) {
+		t.Error("step back before the first state")
+	}
+	for h.Redo(g) {
+	}
+	ExpectUint64(t, "redo", g.Iterations(), 40)
+
+	// the edit saves the next step
+	h.Save(g)
+	g.Set(0, 0, Old)
+	edited := g.Clone()
+	h.SaveStep(g)
+	g.Step()
+	h.SaveStep(g)
+	g.Step()
+	h.StepBack(g)
+	h.StepBack(g)
+	sameGrid(t, "edited", g, edited)
+}
+
+func TestUndoBytes(t *testing.T) {
+	g := NewGrid(64, 10) // 320 bytes
+	h := NewUndo(10)
+	h.SetMaxBytes(1000)
+	for i := 0; i < 5; i++ {
+		h.Save(g)
+		g.Set(i, 0, Old)
+	}
+	ExpectInt(t, "Undos", h.Undos(), 3)
+	h.SetMaxBytes(0)
+	ExpectInt(t, "the last state", h.Undos(), 1)
+}
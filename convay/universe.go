@@ -0,0 +1,33 @@
+package convay
+
+import (
+	"io"
+)
+
+// Universe is the plane of cells, either the bounded Grid or the
+// unbounded Sparse.
+type Universe interface {
+	Get(x, y int) uint64
+	Set(x, y int, v uint64)
+	// ReadRow packs the cells of the row y starting from x0 into dst.
+	ReadRow(dst []uint64, x0, y int)
+	SetDots(y, x int, dots string)
+	InitConfig(name string)
+	Place(p *Pattern, x, y int)
+	// PlaceCentered places the pattern into the centre shifted by (dx,dy).
+	PlaceCentered(p *Pattern, dx, dy int)
+	Clean()
+	Counts() (young, old int)
+	// Bounds returns the bounding box [x0,x1)x[y0,y1) of the live cells.
+	Bounds() (x0, y0, x1, y1 int)
+	Step()
+	Iterations() uint64
+	Rule() *Rule
+	SetRule(r *Rule)
+	WriteCells(w io.Writer, name string) error
+	// Hash returns the hash of the cells.
+	Hash() uint64
+}
+
+var _ Universe = (*Grid)(nil)
+var _ Universe = (*Sparse)(nil)
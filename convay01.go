@@ -3,29 +3,33 @@ package main
 import (
 	"flag"
 	"fmt"
+	"github.com/bukind/dots/convay"
 	"github.com/gotk3/gotk3/cairo"
 	"github.com/gotk3/gotk3/gdk"
 	"github.com/gotk3/gotk3/gtk"
+	"image"
+	"math"
 	"os"
 	"runtime/pprof"
+	"sync"
+	"time"
 )
 
 var initialConfig = ""
+var snapshotFile = "convay01.snap"
 
-const lowBits64 uint64 = 0x5555555555555555
+var historyFile = "convay01.csv"
 
-const bitsPerCell = 4
-const cellsPerInt = 64 / bitsPerCell
-const cellMask uint64 = (1 << bitsPerCell) - 1
+var imageFile = "convay01.png"
 
-type ShiftType int
+// cycleWindow is the longest period of the detected cycles.
+const cycleWindow = 1000
 
-const (
-	SHIFT_NONE ShiftType = iota
-	SHIFT_FIRST
-	SHIFT_TWO
-	SHIFT_ALL
-)
+// historySize is the number of the generations in the history.
+const historySize = 1000
+
+// undoSize is the number of the states which can be undone.
+const undoSize = 100
 
 func fail(err error) {
 	fmt.Fprintf(os.Stderr, "Failure: %v", err)
@@ -36,25 +40,77 @@ type cellType struct {
 	color *gdk.RGBA
 }
 
-type cellValue struct {
-	young uint64
-	total uint64
-}
-
 type Playground struct {
-	da             *gtk.DrawingArea
-	cellSize       uint
-	area           [][]uint64
-	cellTypes      []*cellType
-	cellsPerRow    int
-	lastIntMask    uint64
-	lastCellOffset uint
-	repeats        int    // how many times to repeat
-	iterations     uint64 // the number of steps passed
-	viewX0         int    // the index of the top-left cell
-	viewY0         int
-	viewXSize      int // the width of the view
-	viewYSize      int
+	da        *gtk.DrawingArea
+	cellSize  uint
+	grid      *convay.Grid
+	sparse    *convay.Sparse // the unbounded plane, replaces the grid if set
+	hashlife  *convay.HashLife
+	jumpHash  uint64 // the hash of the plane stored by the hashlife
+	jump      uint64 // the number of generations of the j key
+	tracker   *convay.Tracker
+	autoStop  bool // stop the run when the cycle is found
+	showGraph bool // draw the history overlay
+	showMap   bool // draw the minimap overlay
+	themes    []*theme
+	theme     int      // the index in the themes
+	fit       bool     // resize the grid to fit the drawing area
+	journal   *Journal // records the actions if set
+	// the selection and the clipboard
+	selecting bool // the selection is being dragged
+	dragX0    int  // the corners of the dragged selection, in cells
+	dragY0    int
+	dragX1    int
+	dragY1    int
+	selected  bool // there is a selection
+	selX0     int  // the corners of the selection, in cells
+	selY0     int
+	selX1     int
+	selY1     int
+	pointerX  int // the cell under the pointer, where the clipboard is pasted
+	pointerY  int
+	clipboard *convay.Pattern
+	// the drawing with the mouse
+	brush     int    // the index in the brushes
+	brushSize int    // the side of the square painted at once
+	painting  bool   // the button is down and the dragging paints
+	stroke    uint64 // the state painted by the dragging
+	// the panning with the middle button
+	panning   bool
+	panX      float64 // the point where the button was pressed
+	panY      float64
+	panViewX0 int // the view when the button was pressed
+	panViewY0 int
+	// the random soup
+	density   float64 // the share of the live cells
+	youngRate float64 // the share of the young cells of the live ones
+	seed      int64   // the seed of the last soup, 0 for none
+	cellTypes []*cellType
+	repeats   int // how many times to repeat
+	// the run loop
+	rate      int       // the target generations per second
+	maxSpeed  bool      // step as many generations as fit into a frame
+	owed      float64   // the generations due at the rate
+	lastTick  time.Time // the time of the previous tick
+	genRate   float64   // the measured generations per second
+	rateGen   uint64    // the generation and the time of the measure
+	rateTime  time.Time
+	viewX0    int // the index of the top-left cell
+	viewY0    int
+	viewXSize int // the width of the view
+	viewYSize int
+	row       []uint64 // the scratch row of the drawing
+	// the worker of the window, see worker.go
+	actions chan func() // the changes sent to the worker, nil without it
+	done    chan struct{}
+	frameMu sync.Mutex
+	frames  [3]*frame      // reused by the worker
+	shown   *frame         // the latest frame published by the worker
+	front   *frame         // the frame used by the GTK thread
+	pending bool           // the redraw of the frame is scheduled
+	queue   []func()       // the changes waiting for the room in the actions
+	painted *[]image.Point // the points of the last change queued, see PaintLater
+	mapped  bool           // the frames have the overview of the minimap
 }
 
 func NewPlayground(cellSize uint, xsize, ysize int) *Playground {
@@ -64,303 +120,776 @@ func NewPlayground(cellSize uint, xsize, ysize int) *Playground {
 	pg.viewY0 = 0
 	pg.viewXSize = xsize
 	pg.viewYSize = ysize
+	pg.jump = 1024
+	pg.rate = defaultRate
+	pg.brushSize = 1
+	pg.density = defaultDensity
+	pg.youngRate = defaultYoung
+	pg.tracker = convay.NewTracker(undoSize, cycleWindow, historySize)
 	return pg
 }
 
-//     01 01 01 01 prev
-//     >> 01 01 01 01 prev+   -> 11 11 11 11
-//  01 01 01 01 << prev-
-//
-//     01 01 01 01 this - ignored
-//     >> 01 01 01 01 this+   -> 10 10 10 10
-//  01 01 01 01 << this-
-//
-//     01 01 01 01 next       -> 11 11 11 11
-//     >> 01 01 01 01 next+
-//  01 01 01 01 << next-
-
-func cellSplit(x uint64) cellValue {
-	const lowMask uint64 = 0x3333333333333333
-	y := x & lowMask
-	return cellValue{y, (x>>2)&lowMask + y}
-}
-
-// Makes a running sum of the row.
-// Result is the array of (young,total)
-func tripleRow(orig []uint64, lco uint, lim uint64) []cellValue {
-	nint := len(orig)
-	result := make([]cellValue, nint)
-	mask := cellMask
-	ls := uint(bitsPerCell)
-	rs := uint(64 - bitsPerCell)
-	for i := 1; i < nint-1; i++ {
-		o := orig[i]
-		a := orig[i-1]
-		b := orig[i+1]
-		x := o + (o >> ls) + (b << rs) + (o << ls) + (a >> rs)
-		result[i] = cellSplit(x)
-	}
-	if nint > 1 {
-		o := orig[0]
-		a := orig[nint-1]
-		b := orig[1]
-		x := o + (o >> ls) + (b << rs) + (o << ls) + ((a >> lco) & mask)
-		result[0] = cellSplit(x)
-		o = orig[nint-1]
-		a = orig[nint-2]
-		b = orig[0]
-		x = o + (o >> ls) + ((b & mask) << lco) + (o << ls) + (a >> rs)
-		x &= lim
-		result[nint-1] = cellSplit(x)
+func (pg *Playground) Init(nx, ny int) {
+	// define cell types
+	if pg.themes == nil {
+		pg.themes = builtinThemes()
+	}
+	pg.SetTheme(pg.theme)
+
+	pg.grid = convay.NewGrid(nx, ny)
+	pg.repeats = 0
+
+	pg.grid.InitConfig(initialConfig)
+	pg.Touch()
+}
+
+// SetTheme changes the colours to the i-th theme, wrapping around.
+func (pg *Playground) SetTheme(i int) {
+	pg.theme = i % len(pg.themes)
+	pg.cellTypes = pg.themes[pg.theme].cellTypes
+}
+
+// InitInfinite switches the playground to the unbounded plane with the
+// rule of the grid, the initial configuration is in the middle of the
+// view.
+func (pg *Playground) InitInfinite() {
+	pg.sparse = convay.NewSparse()
+	pg.sparse.SetRule(pg.grid.Rule())
+	pg.sparse.InitConfig(initialConfig)
+	pg.viewX0 = -pg.viewXSize / int(pg.cellSize) / 2
+	pg.viewY0 = -pg.viewYSize / int(pg.cellSize) / 2
+	pg.tracker.Undo.Reset()
+	pg.Touch()
+}
+
+// Fit resizes the grid to nx*ny cells, the ones filling the drawing area,
+// and tells if the size has changed.  The cells keep their coordinates,
+// the plane is never resized.
+func (pg *Playground) Fit(nx, ny int) bool {
+	if pg.sparse != nil || nx <= 0 || ny <= 0 ||
+		(nx == pg.grid.Width() && ny == pg.grid.Height()) {
+		return false
+	}
+	pg.record("fit", nx, ny)
+	pg.Edit()
+	pg.grid.Resize(nx, ny)
+	pg.selected = false
+	pg.Touch()
+	return true
+}
+
+// universe returns the active universe, the plane or the grid.
+func (pg *Playground) universe() convay.Universe {
+	if pg.sparse != nil {
+		return pg.sparse
+	}
+	return pg.grid
+}
+
+// Touch restarts the cycle detection after the cells are changed not by
+// a step.
+func (pg *Playground) Touch() {
+	pg.tracker.Touch(pg.universe())
+}
+
+// Edit saves the state for the undo before the cells are changed.
+func (pg *Playground) Edit() {
+	pg.tracker.Edit(pg.universe())
+}
+
+// Undo restores the previous state, the previous generation if back is
+// set, and tells if there was one.
+func (pg *Playground) Undo(back bool) bool {
+	if back {
+		pg.record("back")
 	} else {
-		o := orig[0]
-		x := o + (o >> ls) + ((o & mask) << lco) + (o << ls) + ((o >> lco) & mask)
-		x &= lim
-		result[0] = cellSplit(x)
+		pg.record("undo")
 	}
-	return result
+	return pg.tracker.Revert(pg.universe(), back)
+}
+
+// Redo restores the last undone state and tells if there was one.
+func (pg *Playground) Redo() bool {
+	pg.record("redo")
+	return pg.tracker.Redo(pg.universe())
 }
 
-// Sumup 8 adjacent cells together.
-// Simple trick is to sumup all 9 cells, then subtrack the central one.
-// Thus we can reuse the running sums of the rows.
-//
-func sumup8(arg [][]cellValue, orig []uint64) []cellValue {
-	nint := len(orig)
-	res := make([]cellValue, nint)
-	a := arg[0]
-	b := arg[1]
-	c := arg[2]
-	for i := 0; i < nint; i++ {
-		v := cellSplit(orig[i])
-		res[i].young = a[i].young + b[i].young + c[i].young - v.young
-		res[i].total = a[i].total + b[i].total + c[i].total - v.total
+// brushCycle is the brush which cycles the state of the clicked cell
+// empty -> young -> old -> empty, the dragging paints the state of the
+// first cell.
+const brushCycle = ^uint64(0)
+
+// brushes are the states the left button paints, switched by the p key.
+var brushes = []uint64{brushCycle, convay.Young, convay.Old, convay.Empty}
+
+// maxBrushSize is the largest side of the brush.
+const maxBrushSize = 16
+
+func brushName(b uint64) string {
+	switch b {
+	case brushCycle:
+		return "cycle"
+	case convay.Young:
+		return "young"
+	case convay.Old:
+		return "old"
 	}
-	return res
+	return "empty"
 }
 
-func (pg *Playground) Step() {
-	// fmt.Printf("step %p\n", pg)
-	nrows := len(pg.area)
-	next := make([][]uint64, nrows) // the next state of the area
-	roll := make([][]cellValue, 3)  // working area
-	first := tripleRow(pg.area[0], pg.lastCellOffset, pg.lastIntMask)
-	last := tripleRow(pg.area[nrows-1], pg.lastCellOffset, pg.lastIntMask)
-	roll[1] = last
-	roll[2] = first
-	for iy := 0; iy < nrows; iy++ {
-		// shift all rows
-		roll[0] = roll[1]
-		roll[1] = roll[2]
-		// fill the next row
-		idx := iy + 1
-		if idx < nrows {
-			roll[2] = tripleRow(pg.area[idx], pg.lastCellOffset, pg.lastIntMask)
+// nextState returns the state of the clicked cell.
+func nextState(v uint64) uint64 {
+	switch v {
+	case convay.Empty:
+		return convay.Young
+	case convay.Young:
+		return convay.Old
+	}
+	return convay.Empty
+}
+
+// BeginStroke starts painting the state v, the stroke is one edit.
+func (pg *Playground) BeginStroke(v uint64) {
+	pg.record("stroke", v)
+	pg.Edit()
+	pg.stroke = v
+}
+
+// Paint paints the square of the brush size centred on (x,y) with the
+// state of the current stroke.  It does not Touch the playground, the
+// caller does it once after the points painted together.
+func (pg *Playground) Paint(x, y int) {
+	pg.record("paint", x, y, pg.brushSize)
+	u := pg.universe()
+	x -= (pg.brushSize - 1) / 2
+	y -= (pg.brushSize - 1) / 2
+	for dy := 0; dy < pg.brushSize; dy++ {
+		for dx := 0; dx < pg.brushSize; dx++ {
+			u.Set(x+dx, y+dy, pg.stroke)
+		}
+	}
+}
+
+// wraps tells if the view wraps around the edges, i.e. the shown grid is
+// a torus.
+func (pg *Playground) wraps() bool {
+	g := pg.shownGrid()
+	return g != nil && g.Edge() == convay.EdgeTorus
+}
+
+// SetView moves the top-left corner of the view to the cell (x0,y0).
+// The view wraps around the torus and stays inside the other grids.
+func (pg *Playground) SetView(x0, y0 int) {
+	if g := pg.shownGrid(); g != nil {
+		w, h := g.Width(), g.Height()
+		if pg.wraps() {
+			x0 = (x0%w + w) % w
+			y0 = (y0%h + h) % h
 		} else {
-			roll[2] = first
+			x0 = clamp(x0, 0, w-1)
+			y0 = clamp(y0, 0, h-1)
 		}
-		// now sumup all young and total number of adjacent cells.
-		// counts is an array of number of Y (young) and T(total) cells around.
-		counts := sumup8(roll, pg.area[iy])
-		// rules are:
-		// 1. each young cell converts to old.
-		// 2. an empty cell converts to young cell if Y<2 and T=3, otherwise is empty
-		// 3. an old cell remains live if Y<2 and T=[2..3], otherwise is empty
-		nint := len(pg.area[iy])
-		next[iy] = make([]uint64, nint)
-		const ones uint64 = 0x1111111111111111
-		for ix := 0; ix < nint; ix++ {
-			orig := pg.area[iy][ix]
-			noto := ^orig
-			notyoung := ^counts[ix].young
-			total := counts[ix].total
+	}
+	pg.viewX0 = x0
+	pg.viewY0 = y0
+}
 
-			// condition if young less than 2
-			yless2 := (notyoung >> 1) & (notyoung >> 2) & (notyoung >> 3)
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
 
-			// condition if total is 2 or 3
-			nott := ^total
-			total23 := (total >> 1) & (nott >> 2) & (nott >> 3)
+// view is the part of the universe shown in the drawing area: cols*rows
+// cells with the top-left one (x0,y0), size pixels each.  The drawing,
+// the clicks and the zoom all map between the pixels and the cells with
+// it.
+type view struct {
+	x0, y0     int
+	cols, rows int
+	size       float64
+}
 
-			// extract all young cells and convert them into old
-			new1 := (orig & ones) << 2
+// viewSize returns the size of the drawing area in pixels.
+func (pg *Playground) viewSize() (int, int) {
+	if pg.da == nil {
+		return pg.viewXSize, pg.viewYSize
+	}
+	return pg.da.GetAllocatedWidth(), pg.da.GetAllocatedHeight()
+}
 
-			// extract all empty cells
-			empt := noto & (noto >> 2)
-			// convert them into youngs
-			new2 := empt & yless2 & total & total23 & ones
+// view returns the view of the drawing area.  The view wraps around the
+// torus but shows it only once, and it is kept inside the other grids.
+func (pg *Playground) view() view {
+	w, h := pg.viewSize()
+	v := view{x0: pg.viewX0, y0: pg.viewY0, size: float64(pg.cellSize)}
+	v.cols = w / int(pg.cellSize)
+	v.rows = h / int(pg.cellSize)
+	g := pg.shownGrid()
+	if g == nil {
+		return v
+	}
+	ncols, nrows := g.Width(), g.Height()
+	if pg.wraps() {
+		if v.cols > ncols {
+			v.cols = ncols
+		}
+		if v.rows > nrows {
+			v.rows = nrows
+		}
+	} else {
+		v.x0, v.cols = fitView(v.x0, v.cols, ncols)
+		v.y0, v.rows = fitView(v.y0, v.rows, nrows)
+	}
+	return v
+}
+
+// fitView moves the span of n cells from x0 inside the size cells.
+func fitView(x0, n, size int) (int, int) {
+	switch {
+	case n > size:
+		return 0, size
+	case x0+n > size:
+		return size - n, n
+	}
+	return x0, n
+}
+
+// cell returns the cell under the pixel (x,y) and tells if it is shown.
+func (v view) cell(x, y float64) (int, int, bool) {
+	ix := int(math.Floor(x / v.size))
+	iy := int(math.Floor(y / v.size))
+	ok := ix >= 0 && ix < v.cols && iy >= 0 && iy < v.rows
+	return v.x0 + ix, v.y0 + iy, ok
+}
 
-			// extract all old cells
-			olds := orig >> 2
-			// convert them into old
-			new3 := (olds & yless2 & total23 & ones) << 2
+// pixel returns the top-left corner of the cell (x,y).
+func (v view) pixel(x, y int) (float64, float64) {
+	return float64(x-v.x0) * v.size, float64(y-v.y0) * v.size
+}
+
+// viewCells returns the number of cells in the view.
+func (pg *Playground) viewCells() (int, int) {
+	v := pg.view()
+	return v.cols, v.rows
+}
+
+// Pan moves the view by (dx,dy) cells.
+func (pg *Playground) Pan(dx, dy int) {
+	pg.SetView(pg.viewX0+dx, pg.viewY0+dy)
+}
+
+// Center moves the view of cellsX*cellsY cells to the centre of the
+// live cells and tells if there are any.
+func (pg *Playground) Center(cellsX, cellsY int) bool {
+	x0, y0, x1, y1 := pg.shownUniverse().Bounds()
+	if x0 == x1 {
+		return false
+	}
+	cx, cy := x0+(x1-x0)/2, y0+(y1-y0)/2
+	if g := pg.shownGrid(); g != nil {
+		// the box may cross the wrapped edges
+		cx, cy = cx%g.Width(), cy%g.Height()
+	}
+	pg.SetView(cx-cellsX/2, cy-cellsY/2)
+	return true
+}
+
+// cellAt returns the cell under the point of the drawing area and tells
+// if the cell is shown there.
+func (pg *Playground) cellAt(x, y float64) (int, int, bool) {
+	return pg.view().cell(x, y)
+}
 
-			// now combine all three outcomes
-			next[iy][ix] = new1 | new2 | new3
+// zoomStep returns the next cell size to zoom in or out from cs, the same
+// size at the limits.
+func zoomStep(cs uint, in bool) uint {
+	if in {
+		switch {
+		case cs < 4:
+			return cs + 1
+		case cs < 10:
+			return cs + 2
+		case cs < 30:
+			return uint(1.4 * float64(cs))
 		}
-		next[iy][nint-1] &= pg.lastIntMask
+		// too large cell - not zooming
+		return cs
 	}
-	pg.area = next
-	pg.iterations++
-	// fmt.Println("step done\n")
+	switch {
+	case cs > 10:
+		cs = uint(float64(cs) / 1.4)
+		if cs > 10 {
+			cs = 10
+		}
+		return cs
+	case cs > 4:
+		return cs - 2
+	case cs > 1:
+		return cs - 1
+	}
+	// too small cell - not zooming
+	return cs
+}
+
+// Zoom changes the size of the cells to cs keeping the same cell under
+// the point (x,y) of the drawing area where possible.
+func (pg *Playground) Zoom(cs uint, x, y float64) {
+	cx, cy, _ := pg.cellAt(x, y)
+	pg.cellSize = cs
+	pg.SetView(cx-int(math.Floor(x/float64(cs))), cy-int(math.Floor(y/float64(cs))))
 }
 
-func makeCellType(colorName string) *cellType {
-	ct := new(cellType)
-	ct.color = gdk.NewRGBA()
-	if !ct.color.Parse(colorName) {
-		panic("failed to parse color name")
+// Select selects the rectangle with the corners (x0,y0) and (x1,y1).
+func (pg *Playground) Select(x0, y0, x1, y1 int) {
+	pg.record("select", x0, y0, x1, y1)
+	pg.setSelection(x0, y0, x1, y1)
+}
+
+func (pg *Playground) setSelection(x0, y0, x1, y1 int) {
+	pg.selected = true
+	pg.selX0, pg.selY0, pg.selX1, pg.selY1 = x0, y0, x1, y1
+}
+
+// Deselect drops the selection.
+func (pg *Playground) Deselect() {
+	pg.record("deselect")
+	pg.selected = false
+}
+
+// selection returns the top-left corner and the size of the selection.
+func (pg *Playground) selection() (x, y, w, h int) {
+	return rectOf(pg.selX0, pg.selY0, pg.selX1, pg.selY1)
+}
+
+// rectOf returns the top-left corner and the size of the rectangle with
+// the corners (x0,y0) and (x1,y1).
+func rectOf(x0, y0, x1, y1 int) (x, y, w, h int) {
+	x, w = x0, x1-x0
+	if w < 0 {
+		x, w = x1, -w
+	}
+	y, h = y0, y1-y0
+	if h < 0 {
+		y, h = y1, -h
 	}
-	return ct
+	return x, y, w + 1, h + 1
 }
 
-func (pg *Playground) Init(nx, ny int) {
-	fmt.Println("configure-event")
+// Copy copies the selection into the clipboard and tells if there was
+// a selection.
+func (pg *Playground) Copy() bool {
+	pg.record("copy")
+	return pg.copySelection()
+}
 
-	if nx <= 0 {
-		panic("Too narrow area")
+func (pg *Playground) copySelection() bool {
+	if !pg.selected {
+		return false
 	}
-	if ny <= 0 {
-		panic("Too short area")
+	x, y, w, h := pg.selection()
+	pg.clipboard = convay.CopyPattern(pg.universe(), x, y, w, h)
+	return true
+}
+
+// Cut moves the selection into the clipboard and tells if there was a
+// selection.
+func (pg *Playground) Cut() bool {
+	pg.record("cut")
+	if !pg.copySelection() {
+		return false
 	}
+	pg.Edit()
+	x, y, w, h := pg.selection()
+	convay.ClearRect(pg.universe(), x, y, w, h)
+	pg.Touch()
+	return true
+}
 
-	// define cell types
-	pg.cellTypes = make([]*cellType, cellMask+1)
-	pg.cellTypes[0x0] = makeCellType("white")
-	pg.cellTypes[0x1] = makeCellType("lightgreen")
-	pg.cellTypes[0x4] = makeCellType("blue")
-
-	rowLen := (nx + cellsPerInt - 1) / cellsPerInt
-	pg.cellsPerRow = nx
-	lastIntCells := nx - cellsPerInt*(rowLen-1)
-	if lastIntCells <= 0 {
-		panic("Invalid lastIntCells")
-	}
-	// the mask of the last int in the row
-	pg.lastIntMask = ^(^uint64(0) << uint(lastIntCells*bitsPerCell))
-	// the offset the the last cell in the last int
-	pg.lastCellOffset = uint((lastIntCells - 1) * bitsPerCell)
-	for i := 0; i < ny; i++ {
-		row := make([]uint64, rowLen)
-		pg.area = append(pg.area, row)
+// Paste places the clipboard with the top-left corner at (x,y), it
+// wraps around the edges of the grid.  The pasted cells are selected.
+func (pg *Playground) Paste(x, y int) bool {
+	pg.record("paste", x, y)
+	if pg.clipboard == nil {
+		return false
 	}
+	pg.Edit()
+	pg.universe().Place(pg.clipboard, x, y)
+	pg.Touch()
+	pg.setSelection(x, y, x+pg.clipboard.Width-1, y+pg.clipboard.Height-1)
+	return true
+}
+
+// transforms are the rotation and the flips of the selection.
+var transforms = map[string]func(p *convay.Pattern) *convay.Pattern{
+	"rotate": (*convay.Pattern).Rotate,
+	"flipx":  (*convay.Pattern).FlipX,
+	"flipy":  (*convay.Pattern).FlipY,
+}
+
+// Transform rotates or flips the selection in place, or the clipboard
+// if there is no selection, by the name of the transform.
+func (pg *Playground) Transform(name string) {
+	pg.record("transform", name)
+	fn := transforms[name]
+	if !pg.selected {
+		if pg.clipboard != nil {
+			pg.clipboard = fn(pg.clipboard)
+		}
+		return
+	}
+	u := pg.universe()
+	x, y, w, h := pg.selection()
+	p := fn(convay.CopyPattern(u, x, y, w, h))
+	pg.Edit()
+	convay.ClearRect(u, x, y, w, h)
+	u.Place(p, x, y)
+	pg.Touch()
+	pg.setSelection(x, y, x+p.Width-1, y+p.Height-1)
+}
+
+func (pg *Playground) Step() {
+	u := pg.universe()
+	if pg.journal != nil {
+		pg.journal.Step(u.Iterations())
+	}
+	if pg.tracker.Step(u) && pg.autoStop && pg.repeats != 0 {
+		fmt.Printf("stopped: %v\n", pg.tracker.Cycle)
+		pg.repeats = 0
+	}
+}
+
+// jumpPopulation is the population above which the plane is stepped by
+// Jump: the large patterns are mostly the irregular ones like the soups,
+// which the memoized engine makes slower than the steps.
+const jumpPopulation = 1 << 12
+
+// Jump advances n generations.  The small patterns of the plane go
+// through the memoized engine, which keeps its tree and memo between the
+// jumps while the plane is not changed otherwise.  The grid is stepped
+// as the engine does not know the edges.
+func (pg *Playground) Jump(n uint64) {
+	pg.record("jump", n)
+	pg.Edit()
+	u := pg.universe()
+	if pg.sparse == nil || convay.Census(u).Total() > jumpPopulation {
+		for i := uint64(0); i < n; i++ {
+			u.Step()
+		}
+		pg.Touch()
+		return
+	}
+	if pg.hashlife == nil {
+		pg.hashlife = convay.NewHashLife()
+	}
+	h := pg.hashlife
+	// the engine has the plane if only the jumps changed it
+	if h.Iterations() != pg.sparse.Iterations() || h.Rule() != pg.sparse.Rule() ||
+		pg.jumpHash != pg.sparse.Hash() {
+		h.Load(pg.sparse)
+	}
+	h.Advance(n)
+	h.Store(pg.sparse)
+	pg.jumpHash = pg.sparse.Hash()
+	pg.Touch()
+}
+
+func (pg *Playground) Clean() {
+	pg.record("clean")
+	pg.Edit()
+	pg.universe().Clean()
+	pg.Touch()
+}
+
+// CleanHalf cleans the lower half of the grid.
+func (pg *Playground) CleanHalf() error {
+	if pg.sparse != nil {
+		return fmt.Errorf("not supported on the unbounded plane")
+	}
+	pg.record("half")
+	nrows := pg.grid.Height()
+	pg.Edit()
+	pg.grid.CleanRows(nrows/2, nrows)
+	pg.Touch()
+	return nil
+}
+
+// NextEdge switches the grid to the next edge mode.
+func (pg *Playground) NextEdge() error {
+	if pg.sparse != nil {
+		return fmt.Errorf("not supported on the unbounded plane")
+	}
+	pg.record("edge")
+	pg.Edit()
+	pg.grid.SetEdge(pg.grid.Edge().Next())
+	pg.Touch()
+	return nil
+}
+
+// The default share of the live cells of the soup and of the young cells
+// of them.
+const (
+	defaultDensity = 0.3
+	defaultYoung   = 0.5
+)
+
+// newSeed returns the seed of the new soup.
+func newSeed() int64 {
+	return time.Now().UnixNano()
+}
+
+// Soup fills the w*h cells with the top-left one (x,y) with the random
+// soup of the seed at the density and the share of the young cells of
+// the playground.
+func (pg *Playground) Soup(x, y, w, h int, seed int64) {
+	pg.record("soup", x, y, w, h, pg.density, pg.youngRate, seed)
+	pg.Edit()
+	convay.Soup(pg.universe(), x, y, w, h, pg.density, pg.youngRate, seed)
+	pg.seed = seed
+	pg.Touch()
+}
+
+// soupRect returns the top-left corner and the size of the soup: the
+// selection, the whole grid or the view v on the plane.
+func (pg *Playground) soupRect(v view) (x, y, w, h int) {
+	switch {
+	case pg.selected:
+		return pg.selection()
+	case pg.sparse == nil:
+		return 0, 0, pg.grid.Width(), pg.grid.Height()
+	}
+	return v.x0, v.y0, v.cols, v.rows
+}
+
+// Run starts stepping n generations, -1 for no limit.
+func (pg *Playground) Run(n int) {
+	pg.record("run", n)
+	pg.repeats = n
+	pg.startRun(time.Now())
+}
+
+// Stop stops the run.
+func (pg *Playground) Stop() {
+	pg.record("stop")
 	pg.repeats = 0
+}
 
-	switch initialConfig {
-	case "line":
-		pg.setDots(ny/2, nx/2-3, "1222221")
-	case "kaka":
-		pg.setDots(ny/2+0, nx/2, "000000012")
-		pg.setDots(ny/2+1, nx/2, "2100010021")
-		pg.setDots(ny/2+2, nx/2, "0020210021")
-		pg.setDots(ny/2+3, nx/2, "222002122")
-		pg.setDots(ny/2+4, nx/2, "0110101")
-	case "":
-		// do nothing
-	default:
-		pg.setDots(ny/2, nx/2, "221")
-		pg.setDots(ny/2+1, nx/2, "002")
-		pg.setDots(ny/2+2, nx/2, "2")
+// SaveSnapshot writes the shown grid and the view into the file.
+func (pg *Playground) SaveSnapshot(name string) error {
+	s := pg.shownGrid().Snapshot()
+	s.ViewX0 = pg.viewX0
+	s.ViewY0 = pg.viewY0
+	s.CellSize = pg.cellSize
+	return convay.SaveSnapshot(name, s)
+}
+
+// LoadSnapshot replaces the grid and the view with the ones from the file.
+func (pg *Playground) LoadSnapshot(name string) error {
+	s, err := convay.LoadSnapshot(name)
+	if err != nil {
+		return err
+	}
+	grid, err := s.Grid()
+	if err != nil {
+		return err
 	}
+	pg.setGrid(grid)
+	pg.showSnapshot(s)
+	return nil
 }
 
-func (pg *Playground) setDots(y, x int, dots string) {
-	for ; y < 0; y += len(pg.area) {
+// setGrid replaces the grid with the loaded one.  The journal gets the
+// loaded cells, the file may change before the replay.
+func (pg *Playground) setGrid(grid *convay.Grid) {
+	if pg.grid != nil {
+		grid.SetWorkers(pg.grid.Workers())
+		pg.record("load", grid.Width(), grid.Height(), grid.Rule(), grid.Edge(), grid.Iterations())
+		pg.Edit()
 	}
-	for ; y >= len(pg.area); y -= len(pg.area) {
+	pg.grid = grid
+	if pg.journal != nil {
+		pg.journal.addCells(grid)
 	}
-	for ; x < 0; x += pg.cellsPerRow {
+	pg.repeats = 0
+	pg.Touch()
+}
+
+// showSnapshot replaces the view with the one of the snapshot.
+func (pg *Playground) showSnapshot(s *convay.Snapshot) {
+	pg.viewX0 = s.ViewX0
+	pg.viewY0 = s.ViewY0
+	if s.CellSize > 0 {
+		pg.cellSize = s.CellSize
 	}
-	for ; x >= pg.cellsPerRow; x -= pg.cellsPerRow {
+}
+
+// The default target rate of the run, and the rates the keys switch
+// between.
+const defaultRate = 30
+
+var rates = []int{1, 2, 5, 10, 20, 30, 60, 100, 200, 500, 1000}
+
+// frameTime is the shortest interval of the ticks of the run, the max
+// speed steps for the most of it.
+const frameTime = 16 * time.Millisecond
+
+// nextRate returns the next rate of the rates, the faster or the slower
+// one.
+func nextRate(rate int, faster bool) int {
+	if faster {
+		for _, r := range rates {
+			if r > rate {
+				return r
+			}
+		}
+		return rates[len(rates)-1]
 	}
-	// TODO(bukind): optimize the loop
-	for i := 0; i < len(dots); i++ {
-		ix := x / cellsPerInt
-		shift := uint((x - ix*cellsPerInt) * bitsPerCell)
-		var v uint64
-		switch dots[i] {
-		case '0':
-			v = 0
-		case '1':
-			v = 0x1
-		case '2':
-			v = 0x4
+	for i := len(rates) - 1; i >= 0; i-- {
+		if rates[i] < rate {
+			return rates[i]
 		}
-		nv := pg.area[y][ix] & ^(cellMask<<shift) + (v << shift)
-		pg.area[y][ix] = nv
-		x++
 	}
+	return rates[0]
 }
 
-func (pg *Playground) Clean() {
-	for iy := 0; iy < len(pg.area); iy++ {
-		for ix := 0; ix < len(pg.area[iy]); ix++ {
-			pg.area[iy][ix] = 0
+// SetRate changes the target generations per second.
+func (pg *Playground) SetRate(rate int) {
+	pg.rate = rate
+}
+
+// SetMaxSpeed turns the max speed on or off.
+func (pg *Playground) SetMaxSpeed(on bool) {
+	pg.maxSpeed = on
+}
+
+// startRun resets the measure of the run.
+func (pg *Playground) startRun(now time.Time) {
+	pg.owed = 0
+	pg.lastTick = now
+	pg.genRate = 0
+	pg.rateGen = pg.universe().Iterations()
+	pg.rateTime = now
+}
+
+// interval returns the interval of the ticks of the run, 0 if it is
+// stopped.
+func (pg *Playground) interval() time.Duration {
+	if pg.repeats == 0 {
+		return 0
+	}
+	if !pg.maxSpeed && time.Second/time.Duration(pg.rate) > frameTime {
+		return time.Second / time.Duration(pg.rate)
+	}
+	return frameTime
+}
+
+// tick steps the run at the time now: the generations due at the
+// target rate, or as many as fit into the frame at the max speed.  Only
+// the latest generation is drawn.
+func (pg *Playground) tick(now time.Time) {
+	if pg.maxSpeed {
+		deadline := now.Add(frameTime * 3 / 4)
+		for {
+			pg.runStep()
+			if pg.repeats == 0 || !time.Now().Before(deadline) {
+				break
+			}
+		}
+	} else {
+		pg.owed += float64(pg.rate) * now.Sub(pg.lastTick).Seconds()
+		// do not catch up after the stalls
+		if limit := float64(pg.rate)/10 + 1; pg.owed > limit {
+			pg.owed = limit
+		}
+		for ; pg.owed >= 1 && pg.repeats != 0; pg.owed-- {
+			pg.runStep()
 		}
 	}
+	pg.lastTick = now
+	pg.measure(now)
 }
 
-func (pg *Playground) StepAndDraw() {
+// runStep makes one step of the run.
+func (pg *Playground) runStep() {
 	if pg.repeats > 0 {
 		pg.repeats--
-		pg.Step()
-		pg.da.QueueDraw()
-	} else if pg.repeats == -1 {
-		pg.Step()
-		pg.da.QueueDraw()
+	}
+	pg.Step()
+}
+
+// measure updates the measured generations per second twice a second.
+func (pg *Playground) measure(now time.Time) {
+	gen := pg.universe().Iterations()
+	if gen < pg.rateGen {
+		// stepped back
+		pg.rateGen, pg.rateTime = gen, now
+		return
+	}
+	if d := now.Sub(pg.rateTime); d >= time.Second/2 {
+		pg.genRate = float64(gen-pg.rateGen) / d.Seconds()
+		pg.rateGen, pg.rateTime = gen, now
 	}
 }
 
 func (pg *Playground) ShowAll() {
-	for iy := 0; iy < len(pg.area); iy++ {
-		for ix := 0; ix < len(pg.area[iy]); ix++ {
-			showbin(pg.area[iy][ix])
+	for iy := 0; iy < pg.grid.Height(); iy++ {
+		for _, v := range pg.grid.Row(iy) {
+			showbin(v)
 		}
 	}
 }
 
-func areaDrawEvent(da *gtk.DrawingArea, cr *cairo.Context, pg *Playground) {
-	_ = cr
+// painter draws the filled rectangles: on the cairo context of the
+// window or on the image of the export.
+type painter interface {
+	setColor(c *gdk.RGBA)
+	rect(x, y, w, h float64) // adds the rectangle to be filled
+	fill()                   // fills the rectangles added
+	paint()                  // fills everything
+}
+
+type cairoPainter struct {
+	cr *cairo.Context
+}
+
+func (p cairoPainter) setColor(c *gdk.RGBA)    { setColor(p.cr, c) }
+func (p cairoPainter) rect(x, y, w, h float64) { p.cr.Rectangle(x, y, w, h) }
+func (p cairoPainter) fill()                   { p.cr.Fill() }
+func (p cairoPainter) paint()                  { p.cr.Paint() }
+
+// drawCells draws the cells of the view of the universe with the colours
+// of the theme, the gaps and the grid lines.  It returns the numbers of
+// the young and the other live cells drawn.
+func (pg *Playground) drawCells(p painter, u convay.Universe, v view) (news, olds int) {
 	var gapSize uint = 0
 	if pg.cellSize > 3 {
 		gapSize = pg.cellSize / 4
 	}
 	dx := float64(pg.cellSize)
 	cs := float64(pg.cellSize - gapSize)
-	olds := 0
-	news := 0
-	// calculate the viewport parameters
-	cellsX := da.GetAllocatedWidth() / int(pg.cellSize)
-	cellsY := da.GetAllocatedHeight() / int(pg.cellSize)
-	startY := pg.viewY0
-	startX := pg.viewX0
-	endY := startY + cellsY
-	endX := startX + cellsX
-	if endY > len(pg.area) {
-		if cellsY > len(pg.area) {
-			startY = 0
-		} else {
-			startY = len(pg.area) - cellsY
-		}
-		endY = len(pg.area)
+	startX, startY := v.x0, v.y0
+	endY := startY + v.rows
+	ncells := v.cols
+	nints := (ncells + convay.CellsPerInt - 1) / convay.CellsPerInt
+	if cap(pg.row) < nints {
+		pg.row = make([]uint64, nints)
 	}
-	if startX+cellsX > pg.cellsPerRow {
-		if cellsX > pg.cellsPerRow {
-			startX = 0
-		} else {
-			startX = pg.cellsPerRow - cellsX
-		}
-		endX = pg.cellsPerRow
-	}
-	// convert X cells into ints
-	cellX0 := startX
-	cellY0 := startY
-	startX = startX / cellsPerInt
-	endX = (endX + cellsPerInt - 1) / cellsPerInt
+	row := pg.row[:nints]
+	t := pg.themes[pg.theme]
+	bw, bh := float64(v.cols)*dx, float64(v.rows)*dx
+	p.setColor(t.background)
+	p.paint()
+	p.setColor(pg.cellTypes[convay.Empty].color)
+	p.rect(0, 0, bw, bh)
+	p.fill()
 
 	for iy := startY; iy < endY; iy++ {
-		row := pg.area[iy]
-		y := float64(iy-cellY0) * dx
+		u.ReadRow(row, startX, iy)
+		y := float64(iy-startY) * dx
 		for mask, cellType := range pg.cellTypes {
 			if mask == 0 || cellType == nil {
 				// optimization - skip empty cells
@@ -370,139 +899,580 @@ func areaDrawEvent(da *gtk.DrawingArea, cr *cairo.Context, pg *Playground) {
 			if mask == 1 {
 				cnt = &news
 			}
-			rgba := cellType.color.Floats()
-			cr.SetSourceRGBA(rgba[0], rgba[1], rgba[2], rgba[3])
-			for ix := startX; ix < endX; ix++ {
-				value := row[ix]
-				idx0 := ix * cellsPerInt
-				maxIdx := idx0 + cellsPerInt
-				if maxIdx > pg.cellsPerRow {
-					maxIdx = pg.cellsPerRow
+			p.setColor(cellType.color)
+			for ix, value := range row {
+				idx0 := ix * convay.CellsPerInt
+				maxIdx := idx0 + convay.CellsPerInt
+				if maxIdx > ncells {
+					maxIdx = ncells
 				}
 				for idx := idx0; idx < maxIdx; idx++ {
-					if int(value&cellMask) == mask {
-						cr.Rectangle(dx*float64(idx-cellX0), y, cs, cs)
+					if int(value&convay.CellMask) == mask {
+						p.rect(dx*float64(idx), y, cs, cs)
 						(*cnt)++
 					}
-					value >>= bitsPerCell
+					value >>= convay.BitsPerCell
 				}
 			}
-			cr.Fill()
+			p.fill()
+		}
+	}
+	if t.gap != nil && gapSize > 0 {
+		p.setColor(t.gap)
+		for i := 0; i < v.cols; i++ {
+			p.rect(float64(i)*dx+cs, 0, float64(gapSize), bh)
+		}
+		for i := 0; i < v.rows; i++ {
+			p.rect(0, float64(i)*dx+cs, bw, float64(gapSize))
+		}
+		p.fill()
+	}
+	if t.grid != nil {
+		p.setColor(t.grid)
+		for i := 0; i <= v.cols; i++ {
+			if pg.onGridLine(startX+i, true) {
+				p.rect(float64(i)*dx, 0, 1, bh)
+			}
 		}
+		for i := 0; i <= v.rows; i++ {
+			if pg.onGridLine(startY+i, false) {
+				p.rect(0, float64(i)*dx, bw, 1)
+			}
+		}
+		p.fill()
+	}
+	return news, olds
+}
+
+func areaDrawEvent(da *gtk.DrawingArea, cr *cairo.Context, pg *Playground) {
+	dx := float64(pg.cellSize)
+	f := pg.current()
+	v := pg.view()
+	t := pg.themes[pg.theme]
+	news, olds := pg.drawCells(cairoPainter{cr}, f.u, v)
+	if pg.selecting || f.selected {
+		x, y, w, h := f.selX, f.selY, f.selW, f.selH
+		if pg.selecting {
+			x, y, w, h = rectOf(pg.dragX0, pg.dragY0, pg.dragX1, pg.dragY1)
+		}
+		cr.SetSourceRGB(1., 0., 0.)
+		cr.SetLineWidth(1.)
+		px, py := v.pixel(x, y)
+		cr.Rectangle(px, py, dx*float64(w), dx*float64(h))
+		cr.Stroke()
+	}
+	if pg.showGraph {
+		drawHistory(cr, pg, f.history, float64(da.GetAllocatedWidth()), float64(da.GetAllocatedHeight()))
+	}
+	if pg.showMap {
+		drawMinimap(cr, pg, pg.minimap(f, da.GetAllocatedWidth()), &f.overview)
 	}
 	cr.MoveTo(1., 14.)
-	cr.SetSourceRGB(0., 0., 0.)
+	setColor(cr, t.text)
 	cr.SetFontSize(12.)
-	total := float64(pg.cellsPerRow * len(pg.area))
-	cr.ShowText(fmt.Sprintf("steps:%d cells:%d/%.1f%%  old:%d/%.1f%%",
-		pg.iterations, olds+news, float64(olds+news)*100/total,
-		olds, float64(olds)*100/total))
+	var status string
+	switch u := f.u.(type) {
+	case *convay.Sparse:
+		status = fmt.Sprintf("steps:%d cells:%d  old:%d  tiles:%d  rule:%s",
+			u.Iterations(), olds+news, olds, u.Tiles(), u.Rule())
+	case *convay.Grid:
+		total := float64(u.Width() * u.Height())
+		status = fmt.Sprintf("steps:%d cells:%d/%.1f%%  old:%d/%.1f%%  rule:%s edge:%v",
+			u.Iterations(), olds+news, float64(olds+news)*100/total,
+			olds, float64(olds)*100/total, u.Rule(), u.Edge())
+	}
+	if f.cycle != "" {
+		status += "  " + f.cycle
+	}
+	if f.autoStop {
+		status += "  [autostop]"
+	}
+	status += fmt.Sprintf("  brush:%s/%d", brushName(brushes[pg.brush]), f.brushSize)
+	if f.maxSpeed {
+		status += "  rate:max"
+	} else {
+		status += fmt.Sprintf("  rate:%d", f.rate)
+	}
+	if f.running {
+		status += fmt.Sprintf(" run:%.0f/s", f.genRate)
+	}
+	if f.seed != 0 {
+		status += fmt.Sprintf("  seed:%d", f.seed)
+	}
+	cr.ShowText(status)
+	cr.Stroke()
+}
+
+func setColor(cr *cairo.Context, c *gdk.RGBA) {
+	rgba := c.Floats()
+	cr.SetSourceRGBA(rgba[0], rgba[1], rgba[2], rgba[3])
+}
+
+// onGridLine tells if there is the grid line before the column x, or
+// before the row x if not column.  The lines are every gridStep cells
+// from the origin, the torus wraps the coordinates first.
+func (pg *Playground) onGridLine(x int, column bool) bool {
+	if pg.wraps() {
+		g := pg.shownGrid()
+		n := g.Height()
+		if column {
+			n = g.Width()
+		}
+		x = (x%n + n) % n
+	}
+	return x%gridStep == 0
+}
+
+// drawHistory draws the chart of the population history, the samples
+// from the oldest one, in the bottom-right corner of the w*h area: the
+// total in black, the young and the old cells in their colours.
+func drawHistory(cr *cairo.Context, pg *Playground, samples []convay.Sample, w, h float64) {
+	const gw = 200.
+	const gh = 60.
+	x0 := w - gw - 4
+	y0 := h - gh - 4
+	t := pg.themes[pg.theme]
+	bg, fg := t.background.Floats(), t.text.Floats()
+	cr.SetSourceRGBA(bg[0], bg[1], bg[2], 0.8)
+	cr.Rectangle(x0, y0, gw, gh)
+	cr.FillPreserve()
+	cr.SetSourceRGB(fg[0], fg[1], fg[2])
+	cr.SetLineWidth(1.)
 	cr.Stroke()
-	if pg.repeats != 0 {
-		pg.StepAndDraw()
+	n := len(samples)
+	if n < 2 {
+		return
+	}
+	top := 1.
+	for _, s := range samples {
+		top = math.Max(top, float64(s.Total()))
+	}
+	series := []struct {
+		rgba  []float64
+		value func(s convay.Sample) int
+	}{
+		{fg, convay.Sample.Total},
+		{pg.cellTypes[convay.Young].color.Floats(), func(s convay.Sample) int { return s.Young }},
+		{pg.cellTypes[convay.Old].color.Floats(), func(s convay.Sample) int { return s.Old }},
+	}
+	for _, sr := range series {
+		cr.SetSourceRGBA(sr.rgba[0], sr.rgba[1], sr.rgba[2], sr.rgba[3])
+		for i := 0; i < n; i++ {
+			x := x0 + gw*float64(i)/float64(n-1)
+			y := y0 + gh - gh*float64(sr.value(samples[i]))/top
+			if i == 0 {
+				cr.MoveTo(x, y)
+			} else {
+				cr.LineTo(x, y)
+			}
+		}
+		cr.Stroke()
+	}
+}
+
+// The largest side of the minimap in pixels.
+const minimapSize = 150
+
+// minimap is the overview of the whole grid, or of the live cells and
+// the view on the plane, in the top-right corner of the drawing area.
+// Every block*block cells are shown as one square of size pixels.
+type minimap struct {
+	x0, y0     int // the top-left cell
+	width      int // the number of cells shown
+	height     int
+	cols, rows int // the number of blocks
+	block      int
+	size       float64
+	left, top  float64 // the top-left corner in the drawing area
+}
+
+// minimapBlock returns the side of the blocks of the minimap of side
+// cells.
+func minimapBlock(side int) int {
+	if side < 1 {
+		side = 1
+	}
+	return (side + minimapSize - 1) / minimapSize
+}
+
+// minimap returns the minimap of the frame f in the drawing area of
+// width w.
+func (pg *Playground) minimap(f *frame, w int) minimap {
+	var m minimap
+	var x1, y1 int
+	if g, ok := f.u.(*convay.Grid); ok {
+		x1, y1 = g.Width(), g.Height()
+	} else {
+		v := pg.view()
+		o := &f.overview
+		m.x0, m.y0, x1, y1 = o.x0, o.y0, o.x0+o.width, o.y0+o.height
+		if o.width == 0 {
+			m.x0, m.y0, x1, y1 = v.x0, v.y0, v.x0, v.y0
+		}
+		if v.x0 < m.x0 {
+			m.x0 = v.x0
+		}
+		if v.y0 < m.y0 {
+			m.y0 = v.y0
+		}
+		if v.x0+v.cols > x1 {
+			x1 = v.x0 + v.cols
+		}
+		if v.y0+v.rows > y1 {
+			y1 = v.y0 + v.rows
+		}
+	}
+	m.width, m.height = x1-m.x0, y1-m.y0
+	side := m.width
+	if m.height > side {
+		side = m.height
+	}
+	if side < 1 {
+		side = 1
+	}
+	m.block = minimapBlock(side)
+	m.cols = (m.width + m.block - 1) / m.block
+	m.rows = (m.height + m.block - 1) / m.block
+	// the small boards are magnified
+	m.size = float64(minimapSize / ((side + m.block - 1) / m.block))
+	m.left = float64(w) - float64(m.cols)*m.size - 4
+	m.top = 4
+	return m
+}
+
+// cell returns the cell under the pixel (x,y) of the drawing area and
+// tells if the pixel is in the minimap.
+func (m minimap) cell(x, y float64) (int, int, bool) {
+	cx := int(math.Floor((x - m.left) / m.size * float64(m.block)))
+	cy := int(math.Floor((y - m.top) / m.size * float64(m.block)))
+	ok := cx >= 0 && cx < m.width && cy >= 0 && cy < m.height
+	return m.x0 + cx, m.y0 + cy, ok
+}
+
+// pixel returns the point of the cell (x,y) in the drawing area.
+func (m minimap) pixel(x, y int) (float64, float64) {
+	return m.left + float64(x-m.x0)*m.size/float64(m.block),
+		m.top + float64(y-m.y0)*m.size/float64(m.block)
+}
+
+// overview is the share of the live cells in the blocks of block*block
+// cells, row by row, of the whole grid or of the live cells of the plane.
+// The worker makes it for the frames, so the minimap only paints it.
+type overview struct {
+	x0, y0     int // the top-left cell
+	width      int // the number of cells, 0 if there are none
+	height     int
+	cols, rows int // the number of blocks
+	block      int
+	density    []float64
+	row        []uint64 // the scratch row
+}
+
+// fill makes o the overview of u, the buffers of o are reused.
+func (o *overview) fill(u convay.Universe) {
+	var x1, y1 int
+	if g, ok := u.(*convay.Grid); ok {
+		o.x0, o.y0, x1, y1 = 0, 0, g.Width(), g.Height()
+	} else {
+		o.x0, o.y0, x1, y1 = u.Bounds()
+	}
+	o.width, o.height = x1-o.x0, y1-o.y0
+	side := o.width
+	if o.height > side {
+		side = o.height
 	}
+	o.block = minimapBlock(side)
+	o.cols = (o.width + o.block - 1) / o.block
+	o.rows = (o.height + o.block - 1) / o.block
+	if n := o.cols * o.rows; cap(o.density) < n {
+		o.density = make([]float64, n)
+	} else {
+		o.density = o.density[:n]
+		for i := range o.density {
+			o.density[i] = 0
+		}
+	}
+	if n := (o.width + convay.CellsPerInt - 1) / convay.CellsPerInt; cap(o.row) < n {
+		o.row = make([]uint64, n)
+	} else {
+		o.row = o.row[:n]
+	}
+	for iy := 0; iy < o.height; iy++ {
+		u.ReadRow(o.row, o.x0, o.y0+iy)
+		blocks := o.density[iy/o.block*o.cols:]
+		for ix, value := range o.row {
+			for idx := ix * convay.CellsPerInt; value != 0 && idx < o.width; idx++ {
+				if value&convay.CellMask != 0 {
+					blocks[idx/o.block]++
+				}
+				value >>= convay.BitsPerCell
+			}
+		}
+	}
+	for i := range o.density {
+		o.density[i] /= float64(o.block * o.block)
+	}
+}
+
+// CenterOn moves the view so that the cell (x,y) is in its centre.
+func (pg *Playground) CenterOn(x, y int) {
+	v := pg.view()
+	pg.SetView(x-v.cols/2, y-v.rows/2)
+}
+
+// drawMinimap draws the blocks of the overview o shaded by the density of
+// the live cells and the rectangle of the view.
+func drawMinimap(cr *cairo.Context, pg *Playground, m minimap, o *overview) {
+	t := pg.themes[pg.theme]
+	bg, fg := t.background.Floats(), t.text.Floats()
+	w, h := float64(m.cols)*m.size, float64(m.rows)*m.size
+	cr.SetSourceRGBA(bg[0], bg[1], bg[2], 0.8)
+	cr.Rectangle(m.left, m.top, w, h)
+	cr.Fill()
+	rgba := pg.cellTypes[convay.Old].color.Floats()
+	// the blocks of the overview are smaller if the plane shows the view
+	side := float64(o.block) * m.size / float64(m.block)
+	for i, d := range o.density {
+		if d == 0 {
+			continue
+		}
+		// even a single cell is visible
+		cr.SetSourceRGBA(rgba[0], rgba[1], rgba[2], 0.2+0.8*d)
+		x, y := m.pixel(o.x0+i%o.cols*o.block, o.y0+i/o.cols*o.block)
+		cr.Rectangle(x, y, side, side)
+		cr.Fill()
+	}
+	cr.SetSourceRGB(fg[0], fg[1], fg[2])
+	cr.SetLineWidth(1.)
+	cr.Rectangle(m.left, m.top, w, h)
+	cr.Stroke()
+	v := pg.view()
+	x, y := m.pixel(v.x0, v.y0)
+	cr.SetSourceRGB(1., 0., 0.)
+	cr.Rectangle(x, y, float64(v.cols)*m.size/float64(m.block), float64(v.rows)*m.size/float64(m.block))
+	cr.Stroke()
 }
 
 func keyPressEvent(win *gtk.Window, evt *gdk.Event, pg *Playground) {
 	_ = win
 	ev := gdk.EventKey{evt}
 	fmt.Printf("key: val:%d state:%d type:%v\n", ev.KeyVal(), ev.State(), ev.Type())
+	if gdk.ModifierType(ev.State())&gdk.GDK_CONTROL_MASK != 0 {
+		x, y := pg.pointerX, pg.pointerY
+		switch ev.KeyVal() {
+		case gdk.KEY_c:
+			pg.Do(func() {
+				if !pg.Copy() {
+					fmt.Println("nothing is selected")
+				}
+			})
+		case gdk.KEY_x:
+			pg.Do(func() {
+				if !pg.Cut() {
+					fmt.Println("nothing is selected")
+				}
+			})
+		case gdk.KEY_v:
+			pg.Do(func() {
+				if !pg.Paste(x, y) {
+					fmt.Println("the clipboard is empty")
+				}
+			})
+		}
+		return
+	}
 	switch ev.KeyVal() {
 	case gdk.KEY_Escape:
 		gtk.MainQuit()
 	case gdk.KEY_space:
-		pg.Step()
-		pg.da.QueueDraw()
+		pg.Do(pg.Step)
 	case gdk.KEY_C:
-		pg.Clean()
-		pg.da.QueueDraw()
+		pg.Do(pg.Clean)
 	case gdk.KEY_S:
-		{
-			// clean the lower half of the field
-			nint := len(pg.area)
-			for iy := nint / 2; iy < nint; iy++ {
-				for ix := 0; ix < len(pg.area[iy]); ix++ {
-					pg.area[iy][ix] = 0
-				}
+		// clean the lower half of the field
+		pg.Do(func() {
+			if err := pg.CleanHalf(); err != nil {
+				fmt.Println(err)
 			}
-		}
+		})
 	case gdk.KEY_t:
-		pg.repeats += 10
-		pg.StepAndDraw()
+		pg.Do(func() { pg.Run(pg.repeats + 10) })
+	case gdk.KEY_j:
+		pg.Do(func() { pg.Jump(pg.jump) })
+	case gdk.KEY_a:
+		pg.Do(func() {
+			pg.autoStop = !pg.autoStop
+			fmt.Printf("stop on cycle: %v\n", pg.autoStop)
+		})
+	case gdk.KEY_g:
+		pg.showGraph = !pg.showGraph
+		pg.da.QueueDraw()
+	case gdk.KEY_T:
+		pg.SetTheme(pg.theme + 1)
+		fmt.Printf("theme: %s\n", pg.themes[pg.theme].name)
+		pg.da.QueueDraw()
+	case gdk.KEY_m:
+		pg.showMap = !pg.showMap
+		show := pg.showMap
+		pg.Do(func() { pg.mapped = show })
+		pg.da.QueueDraw()
+	case gdk.KEY_i:
+		if err := pg.SaveImage(imageFile); err != nil {
+			fmt.Printf("image: %v\n", err)
+		} else {
+			fmt.Printf("image saved to %s\n", imageFile)
+		}
+	case gdk.KEY_h:
+		pg.Do(func() {
+			if err := pg.tracker.History.SaveCSV(historyFile); err != nil {
+				fmt.Printf("history: %v\n", err)
+			} else {
+				fmt.Printf("history saved to %s\n", historyFile)
+			}
+		})
+	case gdk.KEY_z:
+		pg.Do(func() {
+			pg.repeats = 0
+			if !pg.Undo(false) {
+				fmt.Println("nothing to undo")
+			}
+		})
+	case gdk.KEY_Z:
+		pg.Do(func() {
+			pg.repeats = 0
+			if !pg.Redo() {
+				fmt.Println("nothing to redo")
+			}
+		})
+	case gdk.KEY_b:
+		pg.Do(func() {
+			pg.repeats = 0
+			if !pg.Undo(true) {
+				fmt.Println("no previous generation")
+			}
+		})
+	case gdk.KEY_r:
+		pg.Do(func() { pg.Transform("rotate") })
+	case gdk.KEY_f:
+		pg.Do(func() { pg.Transform("flipx") })
+	case gdk.KEY_F:
+		pg.Do(func() { pg.Transform("flipy") })
+	case gdk.KEY_p:
+		pg.brush = (pg.brush + 1) % len(brushes)
+		pg.da.QueueDraw()
+	case gdk.KEY_plus:
+		pg.Do(func() {
+			if pg.brushSize < maxBrushSize {
+				pg.brushSize++
+			}
+		})
+	case gdk.KEY_minus:
+		pg.Do(func() {
+			if pg.brushSize > 1 {
+				pg.brushSize--
+			}
+		})
+	case gdk.KEY_Left, gdk.KEY_Right, gdk.KEY_Up, gdk.KEY_Down:
+		// move by a quarter of the view
+		cellsX, cellsY := pg.viewCells()
+		sx, sy := cellsX/4+1, cellsY/4+1
+		switch ev.KeyVal() {
+		case gdk.KEY_Left:
+			pg.Pan(-sx, 0)
+		case gdk.KEY_Right:
+			pg.Pan(sx, 0)
+		case gdk.KEY_Up:
+			pg.Pan(0, -sy)
+		case gdk.KEY_Down:
+			pg.Pan(0, sy)
+		}
+		pg.da.QueueDraw()
+	case gdk.KEY_c:
+		if !pg.Center(pg.viewCells()) {
+			fmt.Println("no live cells")
+		}
+		pg.da.QueueDraw()
 	case gdk.KEY_x:
-		pg.repeats = 0
+		pg.Do(pg.Stop)
+	case gdk.KEY_bracketright, gdk.KEY_bracketleft:
+		faster := ev.KeyVal() == gdk.KEY_bracketright
+		pg.Do(func() {
+			pg.SetRate(nextRate(pg.rate, faster))
+			fmt.Printf("rate: %d gen/s\n", pg.rate)
+		})
+	case gdk.KEY_M:
+		pg.Do(func() {
+			pg.SetMaxSpeed(!pg.maxSpeed)
+			fmt.Printf("max speed: %v\n", pg.maxSpeed)
+		})
 	case gdk.KEY_s:
-		pg.repeats = -1
-		pg.StepAndDraw()
+		pg.Do(func() { pg.Run(-1) })
+	case gdk.KEY_R:
+		v := pg.view()
+		seed := newSeed()
+		pg.Do(func() {
+			x, y, w, h := pg.soupRect(v)
+			pg.Soup(x, y, w, h, seed)
+			fmt.Printf("soup: %d,%d %dx%d seed:%d\n", x, y, w, h, seed)
+		})
+	case gdk.KEY_e:
+		pg.Do(func() {
+			if err := pg.NextEdge(); err != nil {
+				fmt.Println(err)
+			}
+		})
+	case gdk.KEY_w:
+		if pg.shownGrid() == nil {
+			fmt.Println("not supported on the unbounded plane")
+		} else if err := pg.SaveSnapshot(snapshotFile); err != nil {
+			fmt.Printf("save: %v\n", err)
+		} else {
+			fmt.Printf("saved to %s\n", snapshotFile)
+		}
+	case gdk.KEY_l:
+		if pg.shownGrid() == nil {
+			fmt.Println("not supported on the unbounded plane")
+			break
+		}
+		s, err := convay.LoadSnapshot(snapshotFile)
+		var grid *convay.Grid
+		if err == nil {
+			grid, err = s.Grid()
+		}
+		if err != nil {
+			fmt.Printf("load: %v\n", err)
+			break
+		}
+		pg.Do(func() { pg.setGrid(grid) })
+		pg.showSnapshot(s)
+		fmt.Printf("loaded from %s\n", snapshotFile)
+		pg.da.QueueDraw()
 	}
 }
 
 func mouseScrollEvent(win *gtk.Window, evt *gdk.Event, pg *Playground) bool {
 	ev := gdk.EventScroll{evt}
 	dy := ev.DeltaY()
-	var newcs = pg.cellSize
-	if dy < 0 {
-		// zoom in
-		if newcs < 4 {
-			newcs += 1
-		} else if newcs < 10 {
-			newcs += 2
-		} else if newcs < 30 {
-			newcs = uint(1.4 * float64(newcs))
-		} else {
-			// too large cell - not zooming
-		}
-	} else if dy > 0 {
-		// zoom out
-		if newcs > 10 {
-			newcs = uint(float64(newcs) / 1.4)
-			if newcs > 10 {
-				newcs = 10
-			}
-		} else if newcs > 4 {
-			newcs -= 2
-		} else if newcs > 1 {
-			newcs -= 1
-		} else {
-			// too small cell - not zooming
-		}
+	if dy == 0 {
+		return true
 	}
+	newcs := zoomStep(pg.cellSize, dy < 0)
 	if newcs == pg.cellSize {
 		return true
 	}
-
-	// old cell index under the cursor
-	oldX := float64(pg.viewX0) + ev.X()/float64(pg.cellSize)
-	oldY := float64(pg.viewY0) + ev.Y()/float64(pg.cellSize)
-	// find the 0 position so that the same cell is under the cursor
-	newX0 := int(oldX - (ev.X() / float64(newcs)))
-	newY0 := int(oldY - (ev.Y() / float64(newcs)))
-	if newX0 < 0 {
-		newX0 = 0
-	} else if newX0 >= pg.cellsPerRow {
-		newX0 = pg.cellsPerRow - 1
-	}
-	if newY0 < 0 {
-		newY0 = 0
-	} else if newY0 >= len(pg.area) {
-		newY0 = len(pg.area) - 1
-	}
-
+	x0, y0 := pg.viewX0, pg.viewY0
+	pg.Zoom(newcs, ev.X(), ev.Y())
 	fmt.Printf("scroll: dy:%.1f, (x,y):%.1f,%.1f v0:%d,%d -> %d,%d\n",
-		dy, ev.X(), ev.Y(), pg.viewX0, pg.viewY0, newX0, newY0)
-
-	pg.viewX0 = newX0
-	pg.viewY0 = newY0
-	pg.cellSize = newcs
+		dy, ev.X(), ev.Y(), x0, y0, pg.viewX0, pg.viewY0)
 	pg.da.QueueDraw()
 	return true
 }
 
 func showbin(v uint64) string {
 	var r []byte
-	for i := 0; i < cellsPerInt; i++ {
+	for i := 0; i < convay.CellsPerInt; i++ {
 		var c byte
-		switch v & cellMask {
+		switch v & convay.CellMask {
 		case 0:
 			c = '.'
 		case 1:
@@ -515,40 +1485,135 @@ func showbin(v uint64) string {
 			c = '$'
 		}
 		r = append(r, c)
-		v >>= bitsPerCell
+		v >>= convay.BitsPerCell
 	}
 	return string(r)
 }
 
+func areaConfigureEvent(da *gtk.DrawingArea, evt *gdk.Event, pg *Playground) bool {
+	w, h := da.GetAllocatedWidth(), da.GetAllocatedHeight()
+	fmt.Printf("configure-event: %dx%d\n", w, h)
+	pg.viewXSize, pg.viewYSize = w, h
+	if !pg.fit {
+		return false
+	}
+	nx, ny := w/int(pg.cellSize), h/int(pg.cellSize)
+	pg.Do(func() {
+		if pg.Fit(nx, ny) {
+			fmt.Printf("grid: %dx%d\n", nx, ny)
+		}
+	})
+	return false
+}
+
 func mouseClickedEvent(win *gtk.Window, evt *gdk.Event, pg *Playground) bool {
 	ev := gdk.EventButton{evt}
-	dx := float64(pg.cellSize)
-	ix := int(ev.X() / dx)
-	iy := int(ev.Y() / dx)
-	idx := ix / cellsPerInt
-	v := pg.area[iy][idx]
-	shift := uint(bitsPerCell * (ix % cellsPerInt))
+	if ev.Button() == 2 {
+		// start the panning
+		pg.panning = true
+		pg.panX, pg.panY = ev.X(), ev.Y()
+		v := pg.view()
+		pg.panViewX0, pg.panViewY0 = v.x0, v.y0
+		return true
+	}
+	if gdk.ModifierType(ev.State())&gdk.GDK_SHIFT_MASK != 0 {
+		// start the rubber band selection
+		x, y, ok := pg.cellAt(ev.X(), ev.Y())
+		if !ok {
+			return true
+		}
+		pg.dragX0, pg.dragY0, pg.dragX1, pg.dragY1 = x, y, x, y
+		pg.selecting = true
+		pg.da.QueueDraw()
+		return true
+	}
+	if pg.showMap && ev.Button() == 1 {
+		w, _ := pg.viewSize()
+		if x, y, ok := pg.minimap(pg.current(), w).cell(ev.X(), ev.Y()); ok {
+			pg.CenterOn(x, y)
+			pg.da.QueueDraw()
+			return true
+		}
+	}
+	if pg.current().selected {
+		// the click outside of the drag drops the selection
+		pg.Do(pg.Deselect)
+		return true
+	}
+	ix, iy, ok := pg.cellAt(ev.X(), ev.Y())
+	if !ok {
+		// outside of the grid
+		return false
+	}
 	var nv uint64
-	switch (v >> shift) & cellMask {
-	case 0x0:
-		nv = 0x1
-	case 0x1:
-		nv = 0x4
-	case 0x4:
-		nv = 0x0
+	switch ev.Button() {
+	case 1:
+		nv = brushes[pg.brush]
+	case 3:
+		nv = convay.Empty
 	default:
-		nv = 0x0
+		return false
 	}
-	nv <<= shift
-	nv += v & ^(cellMask << shift)
-	fmt.Printf("mouse: btn:%d bnt-val:%d state:%d type:%v ix,iy,idx,i:%d,%d,%d,%d\n",
+	fmt.Printf("mouse: btn:%d bnt-val:%d state:%d type:%v ix,iy,i:%d,%d,%d\n",
 		ev.Button(), ev.ButtonVal(),
 		ev.State(), ev.Type(),
-		ix, iy, idx, ix%cellsPerInt)
-	fmt.Printf("old: %s\n", showbin(v))
-	fmt.Printf("new: %s\n", showbin(nv))
-	pg.area[iy][idx] = nv
-	pg.da.QueueDraw()
+		ix, iy, ix%convay.CellsPerInt)
+	pg.painting = true
+	pg.Do(func() {
+		u := pg.universe()
+		if nv == brushCycle {
+			nv = nextState(u.Get(ix, iy))
+		}
+		word := make([]uint64, 1)
+		x0 := ix - ix%convay.CellsPerInt
+		u.ReadRow(word, x0, iy)
+		v := word[0]
+		// the stroke is one edit, the dragging paints the same state
+		pg.BeginStroke(nv)
+		pg.Paint(ix, iy)
+		pg.Touch()
+		fmt.Printf("old: %s\n", showbin(v))
+		u.ReadRow(word, x0, iy)
+		fmt.Printf("new: %s\n", showbin(word[0]))
+	})
+	return true
+}
+
+func mouseReleasedEvent(win *gtk.Window, evt *gdk.Event, pg *Playground) bool {
+	if pg.selecting {
+		pg.selecting = false
+		x0, y0, x1, y1 := pg.dragX0, pg.dragY0, pg.dragX1, pg.dragY1
+		pg.Do(func() { pg.Select(x0, y0, x1, y1) })
+		x, y, w, h := rectOf(x0, y0, x1, y1)
+		fmt.Printf("selected: %d,%d %dx%d\n", x, y, w, h)
+	}
+	pg.painting = false
+	pg.panning = false
+	return true
+}
+
+func mouseMovedEvent(win *gtk.Window, evt *gdk.Event, pg *Playground) bool {
+	ev := gdk.EventMotion{evt}
+	x, y := ev.MotionVal()
+	if pg.panning {
+		// the cell under the pointer follows it
+		dx := float64(pg.cellSize)
+		pg.SetView(pg.panViewX0-int(math.Round((x-pg.panX)/dx)),
+			pg.panViewY0-int(math.Round((y-pg.panY)/dx)))
+		pg.da.QueueDraw()
+		return true
+	}
+	ix, iy, ok := pg.cellAt(x, y)
+	if !ok {
+		return true
+	}
+	pg.pointerX, pg.pointerY = ix, iy
+	if pg.selecting {
+		pg.dragX1, pg.dragY1 = ix, iy
+		pg.da.QueueDraw()
+	} else if pg.painting {
+		pg.PaintLater(ix, iy)
+	}
 	return true
 }
 
@@ -567,19 +1632,20 @@ func setupWindow(playground *Playground) error {
 		// fullscreen
 		win.Fullscreen()
 	} else {
-		win.SetSizeRequest(playground.viewXSize, playground.viewYSize)
+		win.SetDefaultSize(playground.viewXSize, playground.viewYSize)
 	}
-	win.SetResizable(false)
+	win.SetResizable(true)
 
 	var da *gtk.DrawingArea
 	if da, err = gtk.DrawingAreaNew(); err != nil {
 		return err
 	}
 
-	// link playground and drawing area
+	// link playground and drawing area, the worker redraws it
 	playground.da = da
+	playground.startWorker()
 
-	da.AddEvents(int(gdk.SCROLL_MASK))
+	da.AddEvents(int(gdk.SCROLL_MASK | gdk.POINTER_MOTION_MASK | gdk.BUTTON_PRESS_MASK | gdk.BUTTON_RELEASE_MASK))
 
 	win.Add(da)
 	win.ShowAll()
@@ -588,6 +1654,10 @@ func setupWindow(playground *Playground) error {
 		return err
 	}
 
+	if _, err = da.Connect("configure-event", areaConfigureEvent, playground); err != nil {
+		return err
+	}
+
 	if _, err = win.Connect("key-press-event", keyPressEvent, playground); err != nil {
 		return err
 	}
@@ -596,6 +1666,14 @@ func setupWindow(playground *Playground) error {
 		return err
 	}
 
+	if _, err = win.Connect("button-release-event", mouseReleasedEvent, playground); err != nil {
+		return err
+	}
+
+	if _, err = win.Connect("motion-notify-event", mouseMovedEvent, playground); err != nil {
+		return err
+	}
+
 	if _, err = win.Connect("scroll-event", mouseScrollEvent, playground); err != nil {
 		return err
 	}
@@ -611,6 +1689,30 @@ func main() {
 	var ysize int
 	var nx int
 	var ny int
+	var rule string
+	var edge string
+	var workers int
+	var pattern string
+	var patternState string
+	var px int
+	var py int
+	var resume string
+	var infinite bool
+	var jump uint64
+	var autoStop bool
+	var fit bool
+	var themesFile string
+	var themeName string
+	var export string
+	var journal string
+	var rate int
+	var replay string
+	var frames int
+	var delay int
+	var soup bool
+	var density float64
+	var young float64
+	var seed int64
 
 	flag.IntVar(&xsize, "xsize", 400, "Set the X viewport size, or -1")
 	flag.IntVar(&ysize, "ysize", 400, "Set the Y viewport size, or -1")
@@ -618,16 +1720,131 @@ func main() {
 	flag.IntVar(&ny, "ny", 40, "Set the number of cells per Y")
 	flag.UintVar(&cellSize, "cellsize", cellSize, "The size of the cell")
 	flag.StringVar(&initialConfig, "init", initialConfig, "The name of the initial configuration")
+	flag.StringVar(&rule, "rule", convay.DefaultRule, "The rule, e.g. B3/S23/Y01, B36/S23 or the name: conway, highlife, daynight")
+	flag.StringVar(&edge, "edge", "torus", "The edge mode: torus, dead, mirror or klein")
+	flag.IntVar(&workers, "workers", 0, "The number of goroutines to step the grid, 0 for all CPUs")
+	flag.StringVar(&pattern, "pattern", "", "The name of the RLE (.rle) or plaintext (.cells) pattern file")
+	flag.StringVar(&patternState, "pattern-state", "old", "The state of the live pattern cells: young or old")
+	flag.IntVar(&px, "px", 0, "The X offset of the pattern from the centre")
+	flag.IntVar(&py, "py", 0, "The Y offset of the pattern from the centre")
+	flag.StringVar(&snapshotFile, "snapshot", snapshotFile, "The name of the snapshot file for the w (save) and l (load) keys")
+	flag.StringVar(&historyFile, "history", historyFile, "The name of the population history CSV file for the h key")
+	flag.StringVar(&resume, "resume", "", "The name of the snapshot file to resume from")
+	flag.BoolVar(&infinite, "infinite", false, "Run on the unbounded plane instead of the grid, ignores -nx, -ny and -edge")
+	flag.Uint64Var(&jump, "jump", 1024, "The number of generations of the j key")
+	flag.BoolVar(&autoStop, "autostop", false, "Stop the run when the board dies out, becomes static or oscillates, toggled by the a key")
+	flag.BoolVar(&fit, "fit", false, "Resize the grid to fit the window, -nx and -ny are only the initial size")
+	flag.StringVar(&themesFile, "themes", "", "The name of the file with the colour themes added to the built-in ones")
+	flag.StringVar(&themeName, "theme", "light", "The name of the colour theme, the T key cycles the themes")
+	flag.StringVar(&imageFile, "image", imageFile, "The name of the PNG file for the i key")
+	flag.StringVar(&export, "export", "", "Write the generations into the .gif animation or the numbered .png files and exit, no window is opened")
+	flag.IntVar(&frames, "frames", 1, "The number of the generations of -export")
+	flag.IntVar(&delay, "delay", 10, "The delay between the frames of the -export animation, in 1/100s")
+	flag.StringVar(&journal, "record", "", "Record the edits and the steps into the journal file")
+	flag.StringVar(&replay, "replay", "", "Replay the journal file before the window is opened or the -export")
+	flag.BoolVar(&soup, "soup", false, "Fill the grid, or the view on the plane, with the random soup, the R key fills the selection or the whole area with a new one")
+	flag.Float64Var(&density, "soup-density", defaultDensity, "The share of the live cells of the soup")
+	flag.Float64Var(&young, "soup-young", defaultYoung, "The share of the young cells of the live ones of the soup")
+	flag.Int64Var(&seed, "seed", 0, "The seed of the -soup, 0 for a new one, the seed is shown in the status line")
+	flag.IntVar(&rate, "rate", defaultRate, "The target generations per second of the run, the [ and ] keys change it, M is the max speed")
 	flag.StringVar(&prof, "prof", "", "The name of the cpu profile output")
 
 	flag.Parse()
 
-	gtk.Init(nil)
+	r, err := convay.ParseRule(rule)
+	if err != nil {
+		fail(err)
+	}
+	e, err := convay.ParseEdge(edge)
+	if err != nil {
+		fail(err)
+	}
+	if infinite {
+		if resume != "" {
+			fail(fmt.Errorf("snapshots are not supported on the unbounded plane"))
+		}
+		if r.Birth&1 != 0 {
+			fail(fmt.Errorf("the rule %s with B0 is not supported on the unbounded plane", r))
+		}
+	}
 
 	playground := NewPlayground(cellSize, xsize, ysize)
+	playground.jump = jump
+	playground.autoStop = autoStop
+	playground.fit = fit
+	if rate < 1 {
+		fail(fmt.Errorf("invalid rate %d", rate))
+	}
+	playground.rate = rate
+	if density <= 0 || density > 1 {
+		fail(fmt.Errorf("invalid soup density %g", density))
+	}
+	if young < 0 || young > 1 {
+		fail(fmt.Errorf("invalid share of the young cells %g", young))
+	}
+	playground.density = density
+	playground.youngRate = young
+	if themesFile != "" {
+		if playground.themes, err = loadThemes(themesFile); err != nil {
+			fail(err)
+		}
+	} else {
+		playground.themes = builtinThemes()
+	}
+	if playground.theme = findTheme(playground.themes, themeName); playground.theme < 0 {
+		fail(fmt.Errorf("unknown theme %q", themeName))
+	}
 	// TODO: should be merged into constructor
 	playground.Init(nx, ny)
+	playground.grid.SetRule(r)
+	playground.grid.SetEdge(e)
+	playground.grid.SetWorkers(workers)
+	if infinite {
+		playground.InitInfinite()
+	}
+	if soup {
+		if seed == 0 {
+			seed = newSeed()
+		}
+		x, y, w, h := playground.soupRect(playground.view())
+		playground.Soup(x, y, w, h, seed)
+		fmt.Printf("soup seed: %d\n", seed)
+	}
+	if pattern != "" {
+		if err := convay.PlacePatternFile(playground.universe(), pattern, patternState, px, py); err != nil {
+			fail(err)
+		}
+		playground.Touch()
+	}
+	if resume != "" {
+		if err := playground.LoadSnapshot(resume); err != nil {
+			fail(err)
+		}
+	}
+
+	if replay != "" {
+		if err := playground.ReplayFile(replay); err != nil {
+			fail(err)
+		}
+	}
 
+	if export != "" {
+		if frames < 1 {
+			fail(fmt.Errorf("invalid number of frames %d", frames))
+		}
+		if err := playground.Record(export, frames, delay); err != nil {
+			fail(err)
+		}
+		return
+	}
+
+	if journal != "" {
+		if err := playground.RecordFile(journal); err != nil {
+			fail(err)
+		}
+	}
+
+	gtk.Init(nil)
 	if err := setupWindow(playground); err != nil {
 		fail(err)
 	}
@@ -640,4 +1857,8 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 	gtk.Main()
+	playground.stopWorker()
+	if err := playground.StopJournal(); err != nil {
+		fail(err)
+	}
 }
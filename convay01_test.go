@@ -1,8 +1,10 @@
 package main
 
 import (
+	"github.com/bukind/dots/convay"
 	"runtime"
 	"testing"
+	"time"
 )
 
 func mku(x ...uint64) []uint64 {
@@ -68,12 +70,10 @@ func TestPlaygroundInit7x5(t *testing.T) {
 	nx := 7
 	ny := 5
 	pg.Init(nx, ny)
-	ExpectInt(t, "len(pg.area)", len(pg.area), ny)
-	ExpectInt(t, "pg.cellsPerRow", pg.cellsPerRow, nx)
-	ExpectInt(t, "len(pg.area[0])", len(pg.area[0]), 1)
+	ExpectInt(t, "pg.grid.Height()", pg.grid.Height(), ny)
+	ExpectInt(t, "pg.grid.Width()", pg.grid.Width(), nx)
+	ExpectInt(t, "len(pg.grid.Row(0))", len(pg.grid.Row(0)), 1)
 	ExpectInt(t, "len(pg.cellTypes)", len(pg.cellTypes), 16)
-	ExpectUint64(t, "pg.lastIntMask", pg.lastIntMask, 0xfffffff)
-	ExpectUint(t, "pg.lastCellOffset", pg.lastCellOffset, 24)
 }
 
 func TestPlaygroundInit800x5(t *testing.T) {
@@ -87,10 +87,424 @@ func TestPlaygroundInit800x5(t *testing.T) {
 	nx := 800
 	ny := 5
 	pg.Init(nx, ny)
-	ExpectInt(t, "len(pg.area)", len(pg.area), ny)
-	ExpectInt(t, "pg.cellsPerRow", pg.cellsPerRow, nx)
-	ExpectInt(t, "len(pg.area[0])", len(pg.area[0]), 50) // 800/16
+	ExpectInt(t, "pg.grid.Height()", pg.grid.Height(), ny)
+	ExpectInt(t, "pg.grid.Width()", pg.grid.Width(), nx)
+	ExpectInt(t, "len(pg.grid.Row(0))", len(pg.grid.Row(0)), 50) // 800/16
 	ExpectInt(t, "len(pg.cellTypes)", len(pg.cellTypes), 16)
-	ExpectUint64(t, "pg.lastIntMask", pg.lastIntMask, allset)
-	ExpectUint(t, "pg.lastCellOffset", pg.lastCellOffset, 60)
+}
+
+func TestPlaygroundJump(t *testing.T) {
+	// the jump through the memoized engine is the same as the steps
+	pg := NewPlayground(7, 70, 70)
+	pg.Init(10, 10)
+	pg.InitInfinite()
+	pg.sparse.InitConfig("kaka")
+	pg.Jump(100)
+	ref := NewPlayground(7, 70, 70)
+	ref.Init(10, 10)
+	ref.InitInfinite()
+	ref.sparse.InitConfig("kaka")
+	for i := 0; i < 100; i++ {
+		ref.Step()
+	}
+	ExpectUint64(t, "iterations", pg.sparse.Iterations(), 100)
+	x0, y0, x1, y1 := ref.sparse.Bounds()
+	for y := y0 - 1; y <= y1; y++ {
+		for x := x0 - 1; x <= x1; x++ {
+			ExpectUint64(t, "cell", pg.sparse.Get(x, y), ref.sparse.Get(x, y))
+		}
+	}
+	young, old := pg.sparse.Counts()
+	ryoung, rold := ref.sparse.Counts()
+	if ryoung+rold == 0 {
+		t.Fatal("the pattern died out")
+	}
+	ExpectInt(t, "young", young, ryoung)
+	ExpectInt(t, "old", old, rold)
+
+	// the next jumps reuse the engine until the plane is edited
+	pg.Jump(30)
+	pg.sparse.Set(40, 40, convay.Old)
+	pg.Jump(20)
+	for i := 0; i < 30; i++ {
+		ref.Step()
+	}
+	ref.sparse.Set(40, 40, convay.Old)
+	for i := 0; i < 20; i++ {
+		ref.Step()
+	}
+	ExpectUint64(t, "iterations", pg.sparse.Iterations(), 150)
+	ExpectUint64(t, "hash", pg.sparse.Hash(), ref.sparse.Hash())
+
+	// the large soup is stepped
+	pg.Soup(0, 0, 100, 100, 1)
+	ref.Soup(0, 0, 100, 100, 1)
+	pg.Jump(10)
+	for i := 0; i < 10; i++ {
+		ref.Step()
+	}
+	ExpectUint64(t, "soup hash", pg.sparse.Hash(), ref.sparse.Hash())
+}
+
+func TestPlaygroundAutoStop(t *testing.T) {
+	pg := NewPlayground(7, 70, 70)
+	pg.Init(10, 10)
+	pg.grid.SetDots(4, 4, "22")
+	pg.grid.SetDots(5, 4, "22")
+	pg.Touch()
+	pg.autoStop = true
+	pg.repeats = -1
+	for i := 0; i < 10 && pg.repeats != 0; i++ {
+		pg.Step()
+	}
+	ExpectInt(t, "pg.repeats", pg.repeats, 0)
+	ExpectInt(t, "Period", pg.tracker.Cycle.Period, 1)
+	ExpectUint64(t, "Start", pg.tracker.Cycle.Start, 0)
+}
+
+func TestPlaygroundHistory(t *testing.T) {
+	pg := NewPlayground(7, 70, 70)
+	pg.Init(10, 10)
+	pg.grid.SetDots(4, 4, "222")
+	pg.Touch()
+	for i := 0; i < 5; i++ {
+		pg.Step()
+	}
+	ExpectInt(t, "Len", pg.tracker.History.Len(), 6)
+	ExpectInt(t, "Total", pg.tracker.History.At(0).Total(), 3)
+	ExpectUint64(t, "Generation", pg.tracker.History.Last().Generation, 5)
+}
+
+func TestPlaygroundUndo(t *testing.T) {
+	pg := NewPlayground(7, 70, 70)
+	pg.Init(10, 10)
+	pg.grid.SetDots(4, 4, "222")
+	pg.Touch()
+	pg.Step()
+	pg.Step()
+	pg.Edit()
+	pg.grid.Set(0, 0, convay.Old)
+	pg.Clean()
+	if !pg.Undo(false) {
+		t.Fatal("nothing to undo")
+	}
+	ExpectUint64(t, "(0,0)", pg.grid.Get(0, 0), convay.Old)
+	if !pg.Undo(true) {
+		t.Fatal("no step back")
+	}
+	ExpectUint64(t, "Iterations", pg.grid.Iterations(), 1)
+	ExpectUint64(t, "(0,0)", pg.grid.Get(0, 0), convay.Empty)
+	ExpectInt(t, "history", pg.tracker.History.Len(), 2)
+	pg.Redo()
+	pg.Redo()
+	ExpectUint64(t, "Iterations", pg.grid.Iterations(), 2)
+	ExpectUint64(t, "(0,0)", pg.grid.Get(0, 0), convay.Old)
+}
+
+func TestPlaygroundClipboard(t *testing.T) {
+	pg := NewPlayground(7, 70, 70)
+	pg.Init(10, 10)
+	pg.grid.SetDots(1, 1, "12")
+	pg.grid.SetDots(2, 1, "02")
+	// the selection is dragged from the bottom-right corner
+	pg.Select(2, 2, 1, 1)
+	if !pg.Cut() {
+		t.Fatal("nothing is cut")
+	}
+	young, old := pg.grid.Counts()
+	ExpectInt(t, "cells after cut", young+old, 0)
+	// the paste wraps around the corner of the torus
+	pg.Paste(9, 9)
+	ExpectUint64(t, "(9,9)", pg.grid.Get(9, 9), convay.Young)
+	ExpectUint64(t, "(0,9)", pg.grid.Get(0, 9), convay.Old)
+	ExpectUint64(t, "(0,0)", pg.grid.Get(0, 0), convay.Old)
+	// the pasted cells are selected and rotated in place
+	pg.Transform("rotate")
+	ExpectUint64(t, "(0,9)", pg.grid.Get(0, 9), convay.Young)
+	ExpectUint64(t, "(9,0)", pg.grid.Get(9, 0), convay.Old)
+	ExpectUint64(t, "(0,0)", pg.grid.Get(0, 0), convay.Old)
+	pg.Undo(false)
+	pg.Undo(false)
+	pg.Undo(false)
+	ExpectUint64(t, "(1,1)", pg.grid.Get(1, 1), convay.Young)
+}
+
+func TestPlaygroundPaint(t *testing.T) {
+	pg := NewPlayground(7, 70, 70)
+	pg.Init(10, 10)
+	pg.brushSize = 3
+	pg.stroke = convay.Old
+	pg.Paint(0, 0) // wraps around the corner
+	young, old := pg.grid.Counts()
+	ExpectInt(t, "young", young, 0)
+	ExpectInt(t, "old", old, 9)
+	ExpectUint64(t, "(9,9)", pg.grid.Get(9, 9), convay.Old)
+	ExpectUint64(t, "(1,1)", pg.grid.Get(1, 1), convay.Old)
+	ExpectUint64(t, "(2,2)", pg.grid.Get(2, 2), convay.Empty)
+	pg.brushSize = 1
+	pg.stroke = convay.Empty
+	pg.Paint(1, 1)
+	ExpectUint64(t, "(1,1)", pg.grid.Get(1, 1), convay.Empty)
+	ExpectUint64(t, "next of old", nextState(convay.Old), convay.Empty)
+}
+
+func TestPlaygroundPan(t *testing.T) {
+	pg := NewPlayground(7, 70, 70)
+	pg.Init(40, 30)
+	pg.Pan(-3, 35)
+	ExpectInt(t, "viewX0", pg.viewX0, 37)
+	ExpectInt(t, "viewY0", pg.viewY0, 5)
+	pg.grid.SetEdge(convay.EdgeDead)
+	pg.Pan(10, -10)
+	ExpectInt(t, "viewX0", pg.viewX0, 39)
+	ExpectInt(t, "viewY0", pg.viewY0, 0)
+	pg.grid.SetEdge(convay.EdgeTorus)
+	pg.grid.SetDots(20, 10, "222")
+	pg.grid.SetDots(24, 16, "2")
+	if !pg.Center(10, 10) {
+		t.Fatal("no live cells")
+	}
+	ExpectInt(t, "viewX0", pg.viewX0, 8)
+	ExpectInt(t, "viewY0", pg.viewY0, 17)
+	pg.InitInfinite()
+	pg.Pan(-100, -100)
+	ExpectInt(t, "viewX0", pg.viewX0, -105)
+}
+
+// zoomLevels returns all cell sizes the zoom goes through.
+func zoomLevels() []uint {
+	levels := []uint{1}
+	for cs := zoomStep(1, true); cs != levels[len(levels)-1]; cs = zoomStep(cs, true) {
+		levels = append(levels, cs)
+	}
+	return levels
+}
+
+func TestPlaygroundZoomLevels(t *testing.T) {
+	levels := zoomLevels()
+	if len(levels) < 5 {
+		t.Fatalf("too few zoom levels %v", levels)
+	}
+	// the zoom out comes back to 1 by smaller steps
+	cs := levels[len(levels)-1]
+	for n := 0; cs > 1; n++ {
+		next := zoomStep(cs, false)
+		if next >= cs || n > len(levels) {
+			t.Fatalf("zoom out of %d: %d", cs, next)
+		}
+		cs = next
+	}
+	ExpectUint(t, "zoom out of 1", zoomStep(1, false), 1)
+}
+
+func TestPlaygroundCellAt(t *testing.T) {
+	pg := NewPlayground(7, 300, 200)
+	pg.Init(40, 30)
+	for _, edge := range []convay.Edge{convay.EdgeTorus, convay.EdgeDead} {
+		pg.grid.SetEdge(edge)
+		for _, cs := range zoomLevels() {
+			pg.cellSize = cs
+			pg.SetView(35, 25)
+			v := pg.view()
+			cols, rows := 300/int(cs), 200/int(cs)
+			if cols > 40 {
+				cols = 40
+			}
+			if rows > 30 {
+				rows = 30
+			}
+			ExpectInt(t, "cols", v.cols, cols)
+			ExpectInt(t, "rows", v.rows, rows)
+			if edge != convay.EdgeTorus {
+				// the view is kept inside the grid
+				ExpectInt(t, "x0", v.x0, 40-cols)
+				ExpectInt(t, "y0", v.y0, 30-rows)
+			}
+			for _, c := range [][2]int{{0, 0}, {cols - 1, rows - 1}, {cols / 2, rows / 3}} {
+				px, py := v.pixel(v.x0+c[0], v.y0+c[1])
+				// any pixel of the cell is mapped to it
+				for _, d := range []float64{0, float64(cs) - 0.5} {
+					x, y, ok := pg.cellAt(px+d, py+d)
+					if !ok || x != v.x0+c[0] || y != v.y0+c[1] {
+						t.Errorf("cs:%d edge:%v cell %d,%d at %.1f,%.1f: %d,%d,%v",
+							cs, edge, c[0], c[1], px+d, py+d, x, y, ok)
+					}
+				}
+			}
+			// the clicks outside of the shown cells are ignored
+			if _, _, ok := pg.cellAt(float64(cols*int(cs)), 0); ok {
+				t.Errorf("cs:%d edge:%v the right of the grid is shown", cs, edge)
+			}
+			if _, _, ok := pg.cellAt(0, -1); ok {
+				t.Errorf("cs:%d edge:%v the top of the grid is shown", cs, edge)
+			}
+		}
+	}
+}
+
+func TestPlaygroundZoom(t *testing.T) {
+	pg := NewPlayground(7, 300, 200)
+	pg.Init(40, 30)
+	pg.InitInfinite()
+	x, y, _ := pg.cellAt(100, 50)
+	levels := zoomLevels()
+	for _, cs := range append(levels, levels[:len(levels)-1]...) {
+		pg.Zoom(cs, 100, 50)
+		ix, iy, ok := pg.cellAt(100, 50)
+		if !ok || ix != x || iy != y {
+			t.Errorf("cs:%d cell under the pointer %d,%d != %d,%d", cs, ix, iy, x, y)
+		}
+	}
+}
+
+func TestPlaygroundFit(t *testing.T) {
+	pg := NewPlayground(10, 400, 400)
+	pg.Init(40, 40)
+	pg.grid.Clean()
+	pg.grid.Set(2, 3, convay.Old)
+	pg.grid.Set(35, 35, convay.Old)
+	if pg.Fit(40, 40) {
+		t.Error("resized to the same size")
+	}
+	pg.viewXSize, pg.viewYSize = 655, 200
+	if !pg.Fit(65, 20) {
+		t.Fatal("not resized")
+	}
+	ExpectInt(t, "width", pg.grid.Width(), 65)
+	ExpectInt(t, "height", pg.grid.Height(), 20)
+	ExpectUint64(t, "(2,3)", pg.grid.Get(2, 3), convay.Old)
+	young, old := pg.grid.Counts()
+	ExpectInt(t, "cells", young+old, 1)
+	v := pg.view()
+	ExpectInt(t, "cols", v.cols, 65)
+	ExpectInt(t, "rows", v.rows, 20)
+	// the cells cut off are back with the undo
+	pg.Undo(false)
+	ExpectInt(t, "width", pg.grid.Width(), 40)
+	ExpectUint64(t, "(35,35)", pg.grid.Get(35, 35), convay.Old)
+	pg.InitInfinite()
+	if pg.Fit(10, 10) {
+		t.Error("the plane is resized")
+	}
+}
+
+func TestPlaygroundMinimap(t *testing.T) {
+	pg := NewPlayground(7, 70, 70)
+	pg.Init(600, 300)
+	pg.grid.Clean()
+	for y := 4; y < 8; y++ {
+		pg.grid.SetDots(y, 8, "2222")
+	}
+	pg.grid.Set(599, 299, convay.Young)
+	pg.mapped = true
+	f := pg.current()
+	m := pg.minimap(f, 700)
+	ExpectInt(t, "block", m.block, 4)
+	ExpectInt(t, "cols", m.cols, 150)
+	ExpectInt(t, "rows", m.rows, 75)
+	ExpectInt(t, "overview block", f.overview.block, 4)
+	d := f.overview.density
+	if d[1*m.cols+2] != 1 || d[len(d)-1] != 1./16 || d[0] != 0 {
+		t.Errorf("invalid density %v %v %v", d[1*m.cols+2], d[len(d)-1], d[0])
+	}
+	x, y, ok := m.cell(m.left+2.5*m.size, m.top+1.5*m.size)
+	if !ok || x != 10 || y != 6 {
+		t.Errorf("invalid cell %d,%d,%v", x, y, ok)
+	}
+	if _, _, ok = m.cell(m.left-1, m.top); ok {
+		t.Error("the left of the minimap is in it")
+	}
+	pg.CenterOn(300, 150)
+	ExpectInt(t, "viewX0", pg.viewX0, 295)
+	ExpectInt(t, "viewY0", pg.viewY0, 145)
+	px, py := m.pixel(pg.viewX0, pg.viewY0)
+	x, y, _ = m.cell(px, py)
+	ExpectInt(t, "x", x, 295)
+	ExpectInt(t, "y", y, 145)
+
+	// the small grid is magnified
+	pg.Init(40, 30)
+	m = pg.minimap(pg.current(), 700)
+	ExpectInt(t, "block", m.block, 1)
+	ExpectInt(t, "size", int(m.size), 3)
+
+	// the plane shows the live cells and the view
+	pg.InitInfinite()
+	pg.sparse.Clean()
+	pg.sparse.Set(100, 50, convay.Old)
+	pg.SetView(-10, -10)
+	f = pg.current()
+	m = pg.minimap(f, 700)
+	ExpectInt(t, "x0", m.x0, -10)
+	ExpectInt(t, "width", m.width, 111)
+	ExpectInt(t, "height", m.height, 61)
+	// the overview has only the live cells
+	ExpectInt(t, "overview x0", f.overview.x0, 100)
+	ExpectInt(t, "overview cols", f.overview.cols, 1)
+	if len(f.overview.density) != 1 || f.overview.density[0] != 1 {
+		t.Errorf("invalid overview density %v", f.overview.density)
+	}
+}
+
+func TestPlaygroundRate(t *testing.T) {
+	ExpectInt(t, "faster", nextRate(30, true), 60)
+	ExpectInt(t, "slower", nextRate(30, false), 20)
+	ExpectInt(t, "fastest", nextRate(1000, true), 1000)
+	ExpectInt(t, "slowest", nextRate(1, false), 1)
+	ExpectInt(t, "between", nextRate(25, true), 30)
+
+	pg := NewPlayground(7, 70, 70)
+	pg.Init(20, 20)
+	pg.SetRate(10)
+	pg.Run(-1)
+	t0 := pg.lastTick
+	pg.tick(t0.Add(100 * time.Millisecond))
+	ExpectUint64(t, "iterations", pg.grid.Iterations(), 1)
+	pg.tick(t0.Add(150 * time.Millisecond))
+	ExpectUint64(t, "iterations", pg.grid.Iterations(), 1)
+	pg.tick(t0.Add(200 * time.Millisecond))
+	ExpectUint64(t, "iterations", pg.grid.Iterations(), 2)
+	// no catching up after the stall
+	pg.tick(t0.Add(5 * time.Second))
+	ExpectUint64(t, "iterations", pg.grid.Iterations(), 4)
+	if pg.genRate < 0.7 || pg.genRate > 0.9 {
+		t.Errorf("invalid measured rate %f", pg.genRate)
+	}
+	pg.Stop()
+	pg.tick(t0.Add(6 * time.Second))
+	ExpectUint64(t, "stopped", pg.grid.Iterations(), 4)
+
+	// the max speed steps many generations at once
+	pg.SetMaxSpeed(true)
+	pg.Run(5)
+	pg.tick(time.Now())
+	ExpectUint64(t, "max speed", pg.grid.Iterations(), 9)
+	ExpectInt(t, "repeats", pg.repeats, 0)
+}
+
+func TestPlaygroundSoup(t *testing.T) {
+	pg := NewPlayground(10, 100, 80)
+	pg.Init(20, 20)
+	x, y, w, h := pg.soupRect(pg.view())
+	if x != 0 || y != 0 || w != 20 || h != 20 {
+		t.Errorf("grid soup %d,%d %dx%d", x, y, w, h)
+	}
+	pg.Select(8, 6, 3, 2)
+	x, y, w, h = pg.soupRect(pg.view())
+	if x != 3 || y != 2 || w != 6 || h != 5 {
+		t.Errorf("selection soup %d,%d %dx%d", x, y, w, h)
+	}
+	pg.Soup(x, y, w, h, 99)
+	ExpectUint64(t, "seed", uint64(pg.current().seed), 99)
+	hash := pg.grid.Hash()
+	pg.Undo(false)
+	pg.Soup(x, y, w, h, 99)
+	ExpectUint64(t, "the same soup", pg.grid.Hash(), hash)
+
+	pg.Deselect()
+	pg.InitInfinite()
+	x, y, w, h = pg.soupRect(pg.view())
+	if x != -5 || y != -4 || w != 10 || h != 8 {
+		t.Errorf("plane soup %d,%d %dx%d", x, y, w, h)
+	}
 }
@@ -0,0 +1,233 @@
+// The convaybatch runs the young/old life without a window.
+// It writes the per-step statistics as CSV and the final grid in the
+// plaintext (.cells) format.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/bukind/dots/convay"
+	"io"
+	"os"
+	"runtime/pprof"
+)
+
+// cycleWindow is the longest period of the detected cycles.
+const cycleWindow = 1000
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "Failure: %v\n", err)
+	os.Exit(1)
+}
+
+// create opens the output file, "-" is the stdout.
+func create(name string) (io.WriteCloser, error) {
+	if name == "-" {
+		return os.Stdout, nil
+	}
+	return os.Create(name)
+}
+
+func writeStats(w io.Writer, s convay.Sample) error {
+	_, err := fmt.Fprintf(w, "%d,%d,%d,%d\n", s.Generation, s.Young, s.Old, s.Total())
+	return err
+}
+
+func main() {
+
+	var nx int
+	var ny int
+	var rule string
+	var edge string
+	var workers int
+	var pattern string
+	var patternState string
+	var px int
+	var py int
+	var resume string
+	var save string
+	var initialConfig string
+	var steps int
+	var out string
+	var stats string
+	var prof string
+	var infinite bool
+	var hashlife bool
+	var autoStop bool
+
+	flag.IntVar(&nx, "nx", 40, "Set the number of cells per X")
+	flag.IntVar(&ny, "ny", 40, "Set the number of cells per Y")
+	flag.StringVar(&initialConfig, "init", initialConfig, "The name of the initial configuration")
+	flag.IntVar(&steps, "steps", 100, "The number of steps to make")
+	flag.StringVar(&out, "out", "-", "The name of the final grid output, or - for stdout")
+	flag.StringVar(&stats, "stats", "", "The name of the per-step statistics output, - for stdout, empty for none")
+	flag.StringVar(&rule, "rule", convay.DefaultRule, "The rule, e.g. B3/S23/Y01, B36/S23 or the name: conway, highlife, daynight")
+	flag.StringVar(&edge, "edge", "torus", "The edge mode: torus, dead, mirror or klein")
+	flag.IntVar(&workers, "workers", 0, "The number of goroutines to step the grid, 0 for all CPUs")
+	flag.StringVar(&pattern, "pattern", "", "The name of the RLE (.rle) or plaintext (.cells) pattern file")
+	flag.StringVar(&patternState, "pattern-state", "old", "The state of the live pattern cells: young or old")
+	flag.IntVar(&px, "px", 0, "The X offset of the pattern from the centre")
+	flag.IntVar(&py, "py", 0, "The Y offset of the pattern from the centre")
+	flag.StringVar(&resume, "resume", "", "The name of the snapshot file to resume from, overrides -nx, -ny and -init, the -rule and -edge given replace the ones of the snapshot")
+	flag.StringVar(&save, "save", "", "The name of the snapshot file to save the final state to")
+	flag.BoolVar(&infinite, "infinite", false, "Run on the unbounded plane instead of the grid, ignores -nx, -ny and -edge")
+	flag.BoolVar(&hashlife, "hashlife", false, "Jump over all steps of the unbounded plane with the memoized engine, the statistics are written only for the final state")
+	flag.BoolVar(&autoStop, "autostop", false, "Stop when the board dies out, becomes static or oscillates, the cycle is reported to stderr")
+	flag.StringVar(&prof, "prof", "", "The name of the cpu profile output")
+
+	flag.Parse()
+
+	r, err := convay.ParseRule(rule)
+	if err != nil {
+		fail(err)
+	}
+	e, err := convay.ParseEdge(edge)
+	if err != nil {
+		fail(err)
+	}
+
+	if nx <= 0 || ny <= 0 {
+		fail(fmt.Errorf("invalid grid size %dx%d", nx, ny))
+	}
+	if steps < 0 {
+		fail(fmt.Errorf("invalid number of steps %d", steps))
+	}
+	if out == "-" && stats == "-" {
+		fail(fmt.Errorf("-out and -stats cannot both be the stdout"))
+	}
+
+	if infinite {
+		if resume != "" || save != "" {
+			fail(fmt.Errorf("snapshots are not supported on the unbounded plane"))
+		}
+		if r.Birth&1 != 0 {
+			fail(fmt.Errorf("the rule %s with B0 is not supported on the unbounded plane", r))
+		}
+	} else if hashlife {
+		fail(fmt.Errorf("-hashlife needs -infinite"))
+	}
+
+	var universe convay.Universe
+	var grid *convay.Grid
+	if infinite {
+		s := convay.NewSparse()
+		s.SetRule(r)
+		s.InitConfig(initialConfig)
+		universe = s
+	} else if resume != "" {
+		s, err := convay.LoadSnapshot(resume)
+		if err != nil {
+			fail(err)
+		}
+		if grid, err = s.Grid(); err != nil {
+			fail(err)
+		}
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "rule":
+				grid.SetRule(r)
+			case "edge":
+				grid.SetEdge(e)
+			}
+		})
+	} else {
+		grid = convay.NewGrid(nx, ny)
+		grid.SetRule(r)
+		grid.SetEdge(e)
+		grid.InitConfig(initialConfig)
+	}
+	if grid != nil {
+		grid.SetWorkers(workers)
+		universe = grid
+	}
+	if pattern != "" {
+		if err := convay.PlacePatternFile(universe, pattern, patternState, px, py); err != nil {
+			fail(err)
+		}
+	}
+
+	var sf io.WriteCloser
+	var sw *bufio.Writer
+	if stats != "" {
+		var err error
+		if sf, err = create(stats); err != nil {
+			fail(err)
+		}
+		sw = bufio.NewWriter(sf)
+		fmt.Fprintln(sw, "step,young,old,total")
+		if err = writeStats(sw, convay.Census(universe)); err != nil {
+			fail(err)
+		}
+	}
+
+	if prof != "" {
+		f, err := os.Create(prof)
+		if err != nil {
+			fail(err)
+		}
+		pprof.StartCPUProfile(f)
+	}
+	if hashlife {
+		s := universe.(*convay.Sparse)
+		h := convay.NewHashLife()
+		h.Load(s)
+		h.Advance(uint64(steps))
+		h.Store(s)
+		if sw != nil && steps > 0 {
+			if err := writeStats(sw, convay.Census(universe)); err != nil {
+				fail(err)
+			}
+		}
+	} else {
+		cycle := convay.NewCycle(cycleWindow)
+		census := convay.Census(universe)
+		for i := 0; i < steps; i++ {
+			if autoStop && cycle.Observe(universe, census) {
+				fmt.Fprintf(os.Stderr, "stopped: %v\n", cycle)
+				break
+			}
+			universe.Step()
+			if sw != nil || autoStop {
+				census = convay.Census(universe)
+			}
+			if sw != nil {
+				if err := writeStats(sw, census); err != nil {
+					fail(err)
+				}
+			}
+		}
+	}
+	if prof != "" {
+		pprof.StopCPUProfile()
+	}
+	if sw != nil {
+		if err := sw.Flush(); err != nil {
+			fail(err)
+		}
+		if sf != os.Stdout {
+			if err := sf.Close(); err != nil {
+				fail(err)
+			}
+		}
+	}
+
+	if save != "" {
+		if err := convay.SaveSnapshot(save, grid.Snapshot()); err != nil {
+			fail(err)
+		}
+	}
+
+	w, err := create(out)
+	if err != nil {
+		fail(err)
+	}
+	if err = universe.WriteCells(w, initialConfig); err != nil {
+		fail(err)
+	}
+	if w != os.Stdout {
+		if err = w.Close(); err != nil {
+			fail(err)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gotk3/gotk3/gdk"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// imagePainter draws on the image, every rectangle is drawn at once.
+type imagePainter struct {
+	img   *image.RGBA
+	color *image.Uniform
+}
+
+func (p *imagePainter) setColor(c *gdk.RGBA) {
+	p.color = image.NewUniform(toColor(c))
+}
+
+func (p *imagePainter) rect(x, y, w, h float64) {
+	r := image.Rect(int(math.Round(x)), int(math.Round(y)), int(math.Round(x+w)), int(math.Round(y+h)))
+	draw.Draw(p.img, r, p.color, image.Point{}, draw.Over)
+}
+
+func (p *imagePainter) fill() {}
+
+func (p *imagePainter) paint() {
+	draw.Draw(p.img, p.img.Bounds(), p.color, image.Point{}, draw.Over)
+}
+
+func toColor(c *gdk.RGBA) color.NRGBA {
+	f := c.Floats()
+	return color.NRGBA{
+		R: uint8(math.Round(f[0] * 255)),
+		G: uint8(math.Round(f[1] * 255)),
+		B: uint8(math.Round(f[2] * 255)),
+		A: uint8(math.Round(f[3] * 255)),
+	}
+}
+
+// exportView returns the view of the exported images: the whole grid or
+// the view of the window on the plane.
+func (pg *Playground) exportView() view {
+	g := pg.shownGrid()
+	if g == nil {
+		return pg.view()
+	}
+	return view{cols: g.Width(), rows: g.Height(), size: float64(pg.cellSize)}
+}
+
+// Image renders the shown generation like the window does, without the
+// status line and the overlays.
+func (pg *Playground) Image() *image.RGBA {
+	v := pg.exportView()
+	cs := int(pg.cellSize)
+	img := image.NewRGBA(image.Rect(0, 0, v.cols*cs, v.rows*cs))
+	pg.drawCells(&imagePainter{img: img}, pg.shownUniverse(), v)
+	return img
+}
+
+// palette returns the colours of the theme for the GIF.
+func (pg *Playground) palette() color.Palette {
+	t := pg.themes[pg.theme]
+	var pal color.Palette
+	add := func(c *gdk.RGBA) {
+		if c == nil {
+			return
+		}
+		nc := toColor(c)
+		for _, pc := range pal {
+			if pc == nc {
+				return
+			}
+		}
+		pal = append(pal, nc)
+	}
+	add(t.background)
+	add(t.gap)
+	add(t.grid)
+	for _, ct := range t.cellTypes {
+		if ct != nil {
+			add(ct.color)
+		}
+	}
+	return pal
+}
+
+// SaveImage writes the shown generation as the PNG.
+func (pg *Playground) SaveImage(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err = png.Encode(f, pg.Image()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// frameName returns the name of the PNG of the generation, e.g.
+// run-000012.png for run.png.
+func frameName(name string, gen uint64) string {
+	ext := filepath.Ext(name)
+	return fmt.Sprintf("%s-%06d%s", strings.TrimSuffix(name, ext), gen, ext)
+}
+
+// Record writes the current generation and the next ones, frames in
+// total.  The .gif name is the animated GIF with the delay between the
+// frames in 1/100s, the other names are the numbered PNGs.
+func (pg *Playground) Record(name string, frames, delay int) error {
+	if v := pg.exportView(); v.cols <= 0 || v.rows <= 0 {
+		return fmt.Errorf("empty view")
+	}
+	if strings.ToLower(filepath.Ext(name)) != ".gif" {
+		for i := 0; i < frames; i++ {
+			if i > 0 {
+				pg.Step()
+			}
+			if err := pg.SaveImage(frameName(name, pg.universe().Iterations())); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	anim := new(gif.GIF)
+	pal := pg.palette()
+	for i := 0; i < frames; i++ {
+		if i > 0 {
+			pg.Step()
+		}
+		img := pg.Image()
+		frame := image.NewPaletted(img.Bounds(), pal)
+		draw.Draw(frame, frame.Bounds(), img, image.Point{}, draw.Src)
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, delay)
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err = gif.EncodeAll(f, anim); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
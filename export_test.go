@@ -0,0 +1,85 @@
+package main
+
+import (
+	"github.com/bukind/dots/convay"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func sameColor(a, b color.Color) bool {
+	ar, ag, ab, aa := a.RGBA()
+	br, bg, bb, ba := b.RGBA()
+	return ar == br && ag == bg && ab == bb && aa == ba
+}
+
+func TestExportImage(t *testing.T) {
+	pg := NewPlayground(4, 70, 70)
+	pg.Init(10, 8)
+	pg.grid.Clean()
+	pg.grid.Set(2, 3, convay.Old)
+	img := pg.Image()
+	ExpectInt(t, "width", img.Bounds().Dx(), 40)
+	ExpectInt(t, "height", img.Bounds().Dy(), 32)
+	th := pg.themes[pg.theme]
+	if !sameColor(img.At(9, 13), toColor(th.cellTypes[convay.Old].color)) {
+		t.Errorf("invalid cell colour %v", img.At(9, 13))
+	}
+	// the gap of the light theme is the empty cell
+	if !sameColor(img.At(11, 13), toColor(th.cellTypes[convay.Empty].color)) {
+		t.Errorf("invalid gap colour %v", img.At(11, 13))
+	}
+	pg.SetTheme(findTheme(pg.themes, "dark"))
+	img = pg.Image()
+	th = pg.themes[pg.theme]
+	if !sameColor(img.At(11, 13), toColor(th.gap)) {
+		t.Errorf("invalid dark gap colour %v", img.At(11, 13))
+	}
+	if !sameColor(img.At(0, 5), toColor(th.grid)) {
+		t.Errorf("invalid grid colour %v", img.At(0, 5))
+	}
+}
+
+func TestExportRecord(t *testing.T) {
+	dir := t.TempDir()
+	pg := NewPlayground(3, 70, 70)
+	pg.Init(20, 10)
+	name := filepath.Join(dir, "run.gif")
+	if err := pg.Record(name, 3, 5); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	anim, err := gif.DecodeAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ExpectInt(t, "frames", len(anim.Image), 3)
+	ExpectInt(t, "delay", anim.Delay[2], 5)
+	ExpectInt(t, "width", anim.Image[0].Bounds().Dx(), 60)
+	ExpectUint64(t, "iterations", pg.grid.Iterations(), 2)
+
+	name = filepath.Join(dir, "run.png")
+	if err := pg.Record(name, 2, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, gen := range []uint64{2, 3} {
+		f, err := os.Open(frameName(name, gen))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = png.Decode(f); err != nil {
+			t.Error(err)
+		}
+		f.Close()
+	}
+	if frameName("a/run.png", 12) != "a/run-000012.png" {
+		t.Errorf("invalid frame name %s", frameName("a/run.png", 12))
+	}
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/bukind/dots/convay"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Journal records the actions which change the playground, so that the
+// session can be replayed.  Every line is "<generation> <action>
+// <args...>".  The journal starts with the universe: "grid <nx> <ny>
+// <rule> <edge>" or "plane <rule>", "set <x> <y> <state>" for the live
+// cells and "start".  The loaded grid is written the same way as "load
+// <nx> <ny> <rule> <edge> <generation>" and its cells.  The consecutive
+// steps are written as one "step <n>" line.
+type Journal struct {
+	w     io.Writer
+	steps uint64 // the steps not written yet
+	gen   uint64 // the generation before them
+	err   error  // the first error of the writing
+}
+
+func NewJournal(w io.Writer) *Journal {
+	j := new(Journal)
+	j.w = w
+	return j
+}
+
+// Add writes the action at the generation.
+func (j *Journal) Add(gen uint64, action string, args ...interface{}) {
+	j.flush()
+	line := strconv.FormatUint(gen, 10) + " " + action
+	for _, a := range args {
+		line += " " + fmt.Sprint(a)
+	}
+	j.write(line)
+}
+
+// Step records the step from the generation.
+func (j *Journal) Step(gen uint64) {
+	if j.steps == 0 {
+		j.gen = gen
+	}
+	j.steps++
+}
+
+// Close writes the pending steps, closes the writer if it is an
+// io.Closer and returns the first error.
+func (j *Journal) Close() error {
+	j.flush()
+	if c, ok := j.w.(io.Closer); ok {
+		if err := c.Close(); j.err == nil {
+			j.err = err
+		}
+	}
+	return j.err
+}
+
+// addCells writes the live cells of the universe as the set actions.
+func (j *Journal) addCells(u convay.Universe) {
+	gen := u.Iterations()
+	x0, y0, x1, y1 := u.Bounds()
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			if v := u.Get(x, y); v != convay.Empty {
+				j.Add(gen, "set", x, y, v)
+			}
+		}
+	}
+}
+
+func (j *Journal) flush() {
+	if j.steps == 0 {
+		return
+	}
+	j.write(fmt.Sprintf("%d step %d", j.gen, j.steps))
+	j.steps = 0
+}
+
+func (j *Journal) write(line string) {
+	if j.err == nil {
+		_, j.err = io.WriteString(j.w, line+"\n")
+	}
+}
+
+// record adds the action to the journal if it is recorded.
+func (pg *Playground) record(action string, args ...interface{}) {
+	if pg.journal != nil {
+		pg.journal.Add(pg.universe().Iterations(), action, args...)
+	}
+}
+
+// StartJournal starts recording the actions into w with the current
+// universe, the states before it can not be undone.
+func (pg *Playground) StartJournal(w io.Writer) {
+	pg.journal = nil
+	// the replay starts with no undo, so must the session
+	pg.tracker.Undo.Reset()
+	j := NewJournal(w)
+	u := pg.universe()
+	gen := u.Iterations()
+	if pg.sparse != nil {
+		j.Add(gen, "plane", pg.sparse.Rule())
+	} else {
+		j.Add(gen, "grid", pg.grid.Width(), pg.grid.Height(), pg.grid.Rule(), pg.grid.Edge())
+	}
+	j.addCells(u)
+	j.Add(gen, "start")
+	pg.journal = j
+}
+
+// RecordFile starts recording the actions into the file, the journal
+// must be closed with StopJournal.
+func (pg *Playground) RecordFile(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	pg.StartJournal(f)
+	return nil
+}
+
+// StopJournal stops the recording and closes the journal.
+func (pg *Playground) StopJournal() error {
+	if pg.journal == nil {
+		return nil
+	}
+	err := pg.journal.Close()
+	pg.journal = nil
+	return err
+}
+
+// Replay makes the universe from the journal and repeats its actions.
+// The runs and the stops only mark the session, their steps are in the
+// journal.  It fails if the generations of the actions differ from the
+// ones recorded.
+func (pg *Playground) Replay(r io.Reader) error {
+	var start, base uint64
+	started := false
+	setting := false // the cells are set or painted, the playground is not touched yet
+	scanner := bufio.NewScanner(r)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		f := strings.Fields(scanner.Text())
+		if len(f) == 0 {
+			continue
+		}
+		if len(f) < 2 {
+			return fmt.Errorf("line %d: no action", lineno)
+		}
+		gen, err := strconv.ParseUint(f[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("line %d: invalid generation %q", lineno, f[0])
+		}
+		if started && gen-start != pg.universe().Iterations()-base {
+			return fmt.Errorf("line %d: generation %d is not %d", lineno,
+				gen, pg.universe().Iterations()-base+start)
+		}
+		painting := f[1] == "set" || f[1] == "paint"
+		if setting && !painting {
+			pg.Touch()
+		}
+		setting = painting
+		if err = pg.replay(f[1], f[2:]); err != nil {
+			return fmt.Errorf("line %d: %v", lineno, err)
+		}
+		if f[1] == "start" {
+			started = true
+			start, base = gen, pg.universe().Iterations()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if setting {
+		pg.Touch()
+	}
+	if !started {
+		return fmt.Errorf("no start")
+	}
+	return nil
+}
+
+// ReplayFile replays the journal file.
+func (pg *Playground) ReplayFile(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err = pg.Replay(f); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	return nil
+}
+
+// replay repeats the action with the arguments.
+func (pg *Playground) replay(action string, args []string) error {
+	n := make([]int, len(args))
+	ints := func(count int) error {
+		if len(args) != count {
+			return fmt.Errorf("%s: %d arguments instead of %d", action, len(args), count)
+		}
+		for i, a := range args {
+			var err error
+			if n[i], err = strconv.Atoi(a); err != nil {
+				return fmt.Errorf("%s: invalid argument %q", action, a)
+			}
+		}
+		return nil
+	}
+	var err error
+	switch action {
+	case "grid", "load":
+		count := 4
+		if action == "load" {
+			count = 5
+		}
+		if len(args) != count {
+			return fmt.Errorf("%s: %d arguments instead of %d", action, len(args), count)
+		}
+		rule, edge := args[2], args[3]
+		var gen uint64
+		if action == "load" {
+			if gen, err = strconv.ParseUint(args[4], 10, 64); err != nil {
+				return fmt.Errorf("load: invalid generation %q", args[4])
+			}
+		}
+		args = args[:2]
+		if err = ints(2); err != nil {
+			return err
+		}
+		if n[0] <= 0 || n[1] <= 0 {
+			return fmt.Errorf("%s: invalid size %dx%d", action, n[0], n[1])
+		}
+		g, err := newGrid(n[0], n[1], rule, edge, gen)
+		if err != nil {
+			return err
+		}
+		if action == "load" {
+			// the cells follow
+			pg.setGrid(g)
+			return nil
+		}
+		if pg.grid != nil {
+			g.SetWorkers(pg.grid.Workers())
+		}
+		pg.grid = g
+		pg.sparse = nil
+		pg.tracker.Undo.Reset()
+		pg.SetView(pg.viewX0, pg.viewY0)
+	case "plane":
+		if len(args) != 1 {
+			return fmt.Errorf("plane: %d arguments instead of 1", len(args))
+		}
+		r, err := convay.ParseRule(args[0])
+		if err != nil {
+			return err
+		}
+		if r.Birth&1 != 0 {
+			return fmt.Errorf("plane: the rule %s with B0 is not supported", r)
+		}
+		pg.sparse = convay.NewSparse()
+		pg.sparse.SetRule(r)
+		pg.tracker.Undo.Reset()
+	case "set":
+		if err = ints(3); err != nil {
+			return err
+		}
+		pg.universe().Set(n[0], n[1], uint64(n[2]))
+	case "start":
+		pg.selected = false
+		pg.clipboard = nil
+		pg.Touch()
+	case "step":
+		if err = ints(1); err != nil {
+			return err
+		}
+		for i := 0; i < n[0]; i++ {
+			pg.Step()
+		}
+	case "jump":
+		if err = ints(1); err != nil {
+			return err
+		}
+		pg.Jump(uint64(n[0]))
+	case "run", "stop":
+		// the steps of the run are recorded
+	case "clean":
+		pg.Clean()
+	case "half":
+		return pg.CleanHalf()
+	case "soup":
+		if len(args) != 7 {
+			return fmt.Errorf("soup: %d arguments instead of 7", len(args))
+		}
+		density, err1 := strconv.ParseFloat(args[4], 64)
+		young, err2 := strconv.ParseFloat(args[5], 64)
+		seed, err3 := strconv.ParseInt(args[6], 10, 64)
+		if err1 != nil || err2 != nil || err3 != nil {
+			return fmt.Errorf("soup: invalid arguments %q", strings.Join(args[4:], " "))
+		}
+		args = args[:4]
+		if err = ints(4); err != nil {
+			return err
+		}
+		pg.density, pg.youngRate = density, young
+		pg.Soup(n[0], n[1], n[2], n[3], seed)
+	case "stroke":
+		if err = ints(1); err != nil {
+			return err
+		}
+		pg.BeginStroke(uint64(n[0]))
+	case "paint":
+		if err = ints(3); err != nil {
+			return err
+		}
+		pg.brushSize = n[2]
+		pg.Paint(n[0], n[1])
+	case "undo":
+		pg.Undo(false)
+	case "back":
+		pg.Undo(true)
+	case "redo":
+		pg.Redo()
+	case "select":
+		if err = ints(4); err != nil {
+			return err
+		}
+		pg.Select(n[0], n[1], n[2], n[3])
+	case "deselect":
+		pg.Deselect()
+	case "copy":
+		pg.Copy()
+	case "cut":
+		pg.Cut()
+	case "paste":
+		if err = ints(2); err != nil {
+			return err
+		}
+		pg.Paste(n[0], n[1])
+	case "transform":
+		if len(args) != 1 || transforms[args[0]] == nil {
+			return fmt.Errorf("invalid transform %q", strings.Join(args, " "))
+		}
+		pg.Transform(args[0])
+	case "edge":
+		return pg.NextEdge()
+	case "fit":
+		if err = ints(2); err != nil {
+			return err
+		}
+		pg.Fit(n[0], n[1])
+	default:
+		return fmt.Errorf("unknown action %q", action)
+	}
+	return nil
+}
+
+// newGrid makes the empty nx*ny grid with the rule, the edge and the
+// generation, the snapshot of the grid sets them all.
+func newGrid(nx, ny int, rule, edge string, gen uint64) (*convay.Grid, error) {
+	s := convay.NewGrid(nx, ny).Snapshot()
+	s.Rule, s.Edge, s.Iterations = rule, edge, gen
+	return s.Grid()
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"github.com/bukind/dots/convay"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// session does the edits and the steps on the playground.
+func session(pg *Playground) {
+	pg.BeginStroke(convay.Old)
+	pg.brushSize = 2
+	pg.Paint(3, 3)
+	pg.Paint(4, 3)
+	pg.Run(-1)
+	for i := 0; i < 5; i++ {
+		pg.Step()
+	}
+	pg.Stop()
+	pg.youngRate = 0.2
+	pg.Soup(5, 8, 10, 6, 12345)
+	pg.Select(1, 1, 6, 4)
+	pg.Cut()
+	pg.Paste(10, 10)
+	pg.Transform("rotate")
+	pg.Deselect()
+	pg.Undo(false)
+	pg.Redo()
+	pg.Step()
+	pg.Jump(7)
+	pg.Undo(true)
+	pg.CleanHalf()
+	pg.NextEdge()
+	pg.Fit(28, 30)
+	pg.Step()
+}
+
+func TestJournalReplay(t *testing.T) {
+	pg := NewPlayground(7, 140, 140)
+	pg.Init(20, 20)
+	var buf bytes.Buffer
+	pg.StartJournal(&buf)
+	session(pg)
+	if err := pg.StopJournal(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "0 step 5\n") {
+		t.Errorf("the steps are not merged:\n%s", buf.String())
+	}
+
+	re := NewPlayground(7, 140, 140)
+	re.Init(5, 5)
+	if err := re.Replay(strings.NewReader(buf.String())); err != nil {
+		t.Fatalf("%v\n%s", err, buf.String())
+	}
+	ExpectInt(t, "width", re.grid.Width(), pg.grid.Width())
+	ExpectInt(t, "height", re.grid.Height(), pg.grid.Height())
+	ExpectUint64(t, "iterations", re.grid.Iterations(), pg.grid.Iterations())
+	ExpectUint64(t, "hash", re.grid.Hash(), pg.grid.Hash())
+	if re.grid.Edge() != pg.grid.Edge() {
+		t.Errorf("edge %v != %v", re.grid.Edge(), pg.grid.Edge())
+	}
+	ExpectInt(t, "undos", re.tracker.Undo.Undos(), pg.tracker.Undo.Undos())
+
+	// the edits before the recording are not undone
+	pg = NewPlayground(7, 140, 140)
+	pg.Init(20, 20)
+	pg.Soup(0, 0, 20, 20, 7)
+	buf.Reset()
+	pg.StartJournal(&buf)
+	if pg.Undo(false) {
+		t.Error("the edit before the journal is undone")
+	}
+	pg.StopJournal()
+	re = NewPlayground(7, 140, 140)
+	re.Init(5, 5)
+	if err := re.Replay(strings.NewReader(buf.String())); err != nil {
+		t.Fatalf("%v\n%s", err, buf.String())
+	}
+	ExpectUint64(t, "hash after the undo", re.grid.Hash(), pg.grid.Hash())
+}
+
+func TestJournalPlane(t *testing.T) {
+	pg := NewPlayground(7, 140, 140)
+	pg.Init(20, 20)
+	pg.InitInfinite()
+	var buf bytes.Buffer
+	pg.StartJournal(&buf)
+	pg.Jump(100)
+	pg.BeginStroke(convay.Young)
+	pg.Paint(-50, -50)
+	pg.Step()
+	pg.StopJournal()
+
+	re := NewPlayground(7, 140, 140)
+	re.Init(20, 20)
+	if err := re.Replay(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if re.sparse == nil {
+		t.Fatal("not on the plane")
+	}
+	ExpectUint64(t, "hash", re.sparse.Hash(), pg.sparse.Hash())
+	ExpectUint64(t, "iterations", re.sparse.Iterations(), 101)
+}
+
+func TestJournalLoad(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "j.snap")
+	pg := NewPlayground(7, 140, 140)
+	pg.Init(20, 20)
+	pg.Jump(3)
+	pg.grid.Set(5, 6, convay.Young)
+	if err := pg.SaveSnapshot(name); err != nil {
+		t.Fatal(err)
+	}
+	pg.Init(30, 10)
+	var buf bytes.Buffer
+	pg.StartJournal(&buf)
+	if err := pg.LoadSnapshot(name); err != nil {
+		t.Fatal(err)
+	}
+	pg.Step()
+	pg.StopJournal()
+	gen, hash, undos := pg.grid.Iterations(), pg.grid.Hash(), pg.tracker.Undo.Undos()
+	// the file changed after the recording
+	pg.grid.Clean()
+	if err := pg.SaveSnapshot(name); err != nil {
+		t.Fatal(err)
+	}
+
+	re := NewPlayground(7, 140, 140)
+	re.Init(5, 5)
+	if err := re.Replay(strings.NewReader(buf.String())); err != nil {
+		t.Fatalf("%v\n%s", err, buf.String())
+	}
+	ExpectInt(t, "width", re.grid.Width(), 20)
+	ExpectUint64(t, "iterations", re.grid.Iterations(), gen)
+	ExpectUint64(t, "hash", re.grid.Hash(), hash)
+	ExpectInt(t, "undos", re.tracker.Undo.Undos(), undos)
+}
+
+func TestJournalErrors(t *testing.T) {
+	for _, bad := range []string{
+		"",
+		"0 grid 10 10 B3/S23 torus\n0 start\n1 step 1",
+		"0 grid 10 10 B3/S23 torus\n0 start\n0 dance",
+		"0 grid 10 B3/S23 torus\n0 start",
+		"0 grid 10 10 B3/S23 square\n0 start",
+		"0 grid 10 10 B3/S23 torus\n0 start\n0 transform twist",
+		"x grid 10 10 B3/S23 torus\n0 start",
+		"0 plane B0/S8\n0 start",
+	} {
+		pg := NewPlayground(7, 70, 70)
+		pg.Init(10, 10)
+		if err := pg.Replay(strings.NewReader(bad)); err == nil {
+			t.Errorf("no error for %q", bad)
+		}
+	}
+}
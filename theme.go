@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/bukind/dots/convay"
+	"github.com/gotk3/gotk3/gdk"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The built-in themes in the format of the themes file.  The line
+// "theme <name>" starts the theme, the other lines are "<key> <colour>"
+// with the keys background, gap, grid, text, empty, young, old and
+// "state <n>" for any of the states 0..15.  The colours are the names or
+// #rrggbb, "none" turns off the gap, the grid or the other states.  The keys
+// not set are the ones of the light theme, the gap and the grid are off.
+const defaultThemes = `
+theme light
+background white
+text black
+empty white
+young lightgreen
+old blue
+
+theme dark
+background black
+gap #202020
+grid #404040
+text #e0e0e0
+empty #101010
+young #40c040
+old #6080ff
+
+theme high-contrast
+background black
+grid #808080
+text yellow
+empty black
+young yellow
+old white
+
+# the Okabe-Ito palette
+theme colour-blind
+background white
+gap #f0f0f0
+grid #c0c0c0
+text black
+empty white
+young #e69f00
+old #0072b2
+`
+
+// The number of cells between the grid lines.
+const gridStep = 10
+
+// theme is the set of the colours of the drawing area.
+type theme struct {
+	name       string
+	background *gdk.RGBA   // the area outside of the cells
+	gap        *gdk.RGBA   // between the cells, nil for the empty cells colour
+	grid       *gdk.RGBA   // the lines every gridStep cells, nil for none
+	text       *gdk.RGBA   // the status line and the charts
+	cellTypes  []*cellType // by the state, nil for the states not drawn
+}
+
+func parseColor(name string) (*gdk.RGBA, error) {
+	c := gdk.NewRGBA()
+	if !c.Parse(name) {
+		return nil, fmt.Errorf("invalid colour %q", name)
+	}
+	return c, nil
+}
+
+// newTheme makes the theme with the colours of the light theme.
+func newTheme(name string) *theme {
+	t := new(theme)
+	t.name = name
+	t.background, _ = parseColor("white")
+	t.text, _ = parseColor("black")
+	t.cellTypes = make([]*cellType, convay.CellMask+1)
+	for state, color := range map[uint64]string{
+		convay.Empty: "white",
+		convay.Young: "lightgreen",
+		convay.Old:   "blue",
+	} {
+		t.cellTypes[state] = new(cellType)
+		t.cellTypes[state].color, _ = parseColor(color)
+	}
+	return t
+}
+
+// readThemes reads the themes in the format of defaultThemes.
+func readThemes(r io.Reader) ([]*theme, error) {
+	var themes []*theme
+	var t *theme
+	scanner := bufio.NewScanner(r)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f := strings.Fields(line)
+		key := f[0]
+		if key == "theme" {
+			if len(f) != 2 {
+				return nil, fmt.Errorf("line %d: invalid theme %q", lineno, line)
+			}
+			t = newTheme(f[1])
+			themes = append(themes, t)
+			continue
+		}
+		if t == nil {
+			return nil, fmt.Errorf("line %d: no theme before %q", lineno, line)
+		}
+		state := -1
+		if key == "state" && len(f) == 3 {
+			n, err := strconv.Atoi(f[1])
+			if err != nil || n < 0 || n > int(convay.CellMask) {
+				return nil, fmt.Errorf("line %d: invalid state %q", lineno, f[1])
+			}
+			state = n
+			f = f[1:]
+		}
+		if len(f) != 2 {
+			return nil, fmt.Errorf("line %d: invalid line %q", lineno, line)
+		}
+		var color *gdk.RGBA
+		if f[1] != "none" {
+			var err error
+			if color, err = parseColor(f[1]); err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineno, err)
+			}
+		} else if (state < 0 && key != "gap" && key != "grid") ||
+			state == int(convay.Empty) || state == int(convay.Young) || state == int(convay.Old) {
+			return nil, fmt.Errorf("line %d: %s can not be none", lineno, line)
+		}
+		switch {
+		case state >= 0 && color == nil:
+			t.cellTypes[state] = nil
+		case state >= 0:
+			t.cellTypes[state] = &cellType{color}
+		case key == "background":
+			t.background = color
+		case key == "gap":
+			t.gap = color
+		case key == "grid":
+			t.grid = color
+		case key == "text":
+			t.text = color
+		case key == "empty":
+			t.cellTypes[convay.Empty] = &cellType{color}
+		case key == "young":
+			t.cellTypes[convay.Young] = &cellType{color}
+		case key == "old":
+			t.cellTypes[convay.Old] = &cellType{color}
+		default:
+			return nil, fmt.Errorf("line %d: unknown key %q", lineno, key)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return themes, nil
+}
+
+// loadThemes reads the themes file and adds its themes to the built-in
+// ones, the themes of the same name are replaced.
+func loadThemes(name string) ([]*theme, error) {
+	themes := builtinThemes()
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	loaded, err := readThemes(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return mergeThemes(themes, loaded), nil
+}
+
+// mergeThemes adds the themes to the list, the themes of the same name
+// are replaced.
+func mergeThemes(themes, add []*theme) []*theme {
+next:
+	for _, t := range add {
+		for i, old := range themes {
+			if old.name == t.name {
+				themes[i] = t
+				continue next
+			}
+		}
+		themes = append(themes, t)
+	}
+	return themes
+}
+
+// findTheme returns the index of the theme, -1 if there is none.
+func findTheme(themes []*theme, name string) int {
+	for i, t := range themes {
+		if t.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func builtinThemes() []*theme {
+	themes, err := readThemes(strings.NewReader(defaultThemes))
+	if err != nil {
+		panic(err)
+	}
+	return themes
+}
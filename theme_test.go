@@ -0,0 +1,94 @@
+package main
+
+import (
+	"github.com/bukind/dots/convay"
+	"strings"
+	"testing"
+)
+
+func TestThemeBuiltin(t *testing.T) {
+	themes := builtinThemes()
+	for _, name := range []string{"light", "dark", "high-contrast", "colour-blind"} {
+		if findTheme(themes, name) < 0 {
+			t.Errorf("no theme %s", name)
+		}
+	}
+	light := themes[findTheme(themes, "light")]
+	if light.gap != nil || light.grid != nil {
+		t.Error("the light theme has the gap or the grid")
+	}
+	for _, th := range themes {
+		for _, state := range []uint64{convay.Empty, convay.Young, convay.Old} {
+			if th.cellTypes[state] == nil {
+				t.Errorf("%s: no colour of %d", th.name, state)
+			}
+		}
+	}
+}
+
+func TestThemeRead(t *testing.T) {
+	themes, err := readThemes(strings.NewReader(`
+# the comment
+theme mine
+background #000000
+gap none
+grid #ff0000
+state 5 #00ff00
+state 2 none
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ExpectInt(t, "themes", len(themes), 1)
+	th := themes[0]
+	if th.name != "mine" || th.gap != nil || th.grid == nil {
+		t.Errorf("invalid theme %+v", th)
+	}
+	if th.cellTypes[5] == nil || th.cellTypes[5].color.Floats()[1] != 1 {
+		t.Error("invalid state 5")
+	}
+	// not set in the file
+	if th.text == nil || th.cellTypes[convay.Old] == nil {
+		t.Error("no default colours")
+	}
+
+	merged := mergeThemes(builtinThemes(), []*theme{newTheme("dark"), th})
+	ExpectInt(t, "merged", len(merged), len(builtinThemes())+1)
+	if merged[findTheme(merged, "dark")].gap != nil {
+		t.Error("the theme is not replaced")
+	}
+
+	for _, bad := range []string{
+		"background white",
+		"theme x\nold none",
+		"theme x\nstate 1 none",
+		"theme x\nstate 16 red",
+		"theme x\ncolour red",
+		"theme x\ntext nocolour",
+		"theme x y",
+	} {
+		if _, err := readThemes(strings.NewReader(bad)); err == nil {
+			t.Errorf("no error for %q", bad)
+		}
+	}
+}
+
+func TestThemeCycle(t *testing.T) {
+	pg := NewPlayground(7, 70, 70)
+	pg.Init(15, 15)
+	n := len(pg.themes)
+	pg.SetTheme(n - 1)
+	if pg.cellTypes[convay.Old] != pg.themes[n-1].cellTypes[convay.Old] {
+		t.Error("the cell types are not of the theme")
+	}
+	pg.SetTheme(pg.theme + 1)
+	ExpectInt(t, "theme", pg.theme, 0)
+	// the torus wraps -10 to 5
+	if pg.onGridLine(-10, true) || !pg.onGridLine(10, false) {
+		t.Error("invalid grid lines on the torus")
+	}
+	pg.InitInfinite()
+	if !pg.onGridLine(-10, true) {
+		t.Error("invalid grid lines on the plane")
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"github.com/bukind/dots/convay"
+	"github.com/gotk3/gotk3/glib"
+	"image"
+	"time"
+)
+
+// The window runs the simulation in the worker goroutine, so that the big
+// boards do not freeze it.  The worker owns the universe and the state
+// around it: the history, the cycle, the undo, the journal, the selection,
+// the clipboard and the run.  The GTK handlers send the changes to it with
+// Do and draw the frames it publishes, they keep only the view, the
+// pointer and the colours.  Without the worker, e.g. in the tests and the
+// export, Do runs the changes at once.
+
+// frame is the state of the playground published by the worker for the
+// drawing.  The worker does not change the frame used by the GTK thread.
+type frame struct {
+	u         convay.Universe // the copy of the current generation
+	cycle     string          // the detected cycle, "" for none
+	autoStop  bool
+	brushSize int
+	rate      int
+	maxSpeed  bool
+	running   bool
+	genRate   float64
+	seed      int64 // the seed of the last soup, 0 for none
+	selected  bool
+	selX      int // the top-left corner and the size of the selection
+	selY      int
+	selW      int
+	selH      int
+	history   []convay.Sample // from the oldest one
+	overview  overview        // of the minimap, none if not mapped
+}
+
+// makeFrame returns the frame of the current state with the universe u.
+func (pg *Playground) makeFrame(u convay.Universe) *frame {
+	f := new(frame)
+	pg.fillFrame(f, u)
+	return f
+}
+
+// fillFrame makes f the frame of the current state with the universe u,
+// the history and the overview of f are reused.
+func (pg *Playground) fillFrame(f *frame, u convay.Universe) {
+	*f = frame{
+		u:         u,
+		autoStop:  pg.autoStop,
+		brushSize: pg.brushSize,
+		rate:      pg.rate,
+		maxSpeed:  pg.maxSpeed,
+		running:   pg.repeats != 0,
+		genRate:   pg.genRate,
+		seed:      pg.seed,
+		selected:  pg.selected,
+		history:   f.history[:0],
+		overview:  f.overview,
+	}
+	if pg.tracker.Cycle.Period != 0 {
+		f.cycle = pg.tracker.Cycle.String()
+	}
+	if f.selected {
+		f.selX, f.selY, f.selW, f.selH = pg.selection()
+	}
+	for i := 0; i < pg.tracker.History.Len(); i++ {
+		f.history = append(f.history, pg.tracker.History.At(i))
+	}
+	if pg.mapped {
+		f.overview.fill(u)
+	} else {
+		f.overview.width, f.overview.height = 0, 0
+		f.overview.density = f.overview.density[:0]
+	}
+}
+
+// current returns the frame to draw.
+func (pg *Playground) current() *frame {
+	if pg.actions == nil {
+		return pg.makeFrame(pg.universe())
+	}
+	return pg.front
+}
+
+// shownUniverse returns the universe to draw, it is not changed by the
+// worker.
+func (pg *Playground) shownUniverse() convay.Universe {
+	if pg.actions == nil {
+		return pg.universe()
+	}
+	return pg.front.u
+}
+
+// acquire makes the latest frame published the one used by the GTK
+// thread, the worker reuses the other ones.
+func (pg *Playground) acquire() {
+	pg.frameMu.Lock()
+	pg.front = pg.shown
+	pg.pending = false
+	pg.frameMu.Unlock()
+}
+
+// shownGrid returns the grid to draw, nil on the plane.
+func (pg *Playground) shownGrid() *convay.Grid {
+	g, _ := pg.shownUniverse().(*convay.Grid)
+	return g
+}
+
+// Do runs the change of the playground in the worker, after the changes
+// sent before it and between the steps of the run.  The change must not
+// call GTK, the worker redraws the area after it.  Do never blocks: the
+// changes wait in the queue while the worker is busy.
+func (pg *Playground) Do(fn func()) {
+	if pg.actions == nil {
+		fn()
+		return
+	}
+	pg.painted = nil
+	pg.queue = append(pg.queue, fn)
+	pg.flush()
+}
+
+// PaintLater paints the point of the current stroke in the worker.  The
+// points painted while the worker is busy are merged into one change.
+func (pg *Playground) PaintLater(x, y int) {
+	if pg.painted != nil {
+		*pg.painted = append(*pg.painted, image.Pt(x, y))
+		return
+	}
+	points := &[]image.Point{image.Pt(x, y)}
+	pg.Do(func() {
+		for _, p := range *points {
+			pg.Paint(p.X, p.Y)
+		}
+		pg.Touch()
+	})
+	if len(pg.queue) > 0 {
+		// not sent yet, the next points join it
+		pg.painted = points
+	}
+}
+
+// flush sends the queued changes the worker has the room for.
+func (pg *Playground) flush() {
+	for len(pg.queue) > 0 {
+		select {
+		case pg.actions <- pg.queue[0]:
+			pg.queue[0] = nil
+			pg.queue = pg.queue[1:]
+		default:
+			return
+		}
+	}
+	pg.queue = nil
+	pg.painted = nil
+}
+
+// startWorker starts the worker, the playground is owned by it until
+// stopWorker.
+func (pg *Playground) startWorker() {
+	pg.publish()
+	pg.acquire()
+	pg.actions = make(chan func(), 64)
+	pg.done = make(chan struct{})
+	go pg.work(pg.actions, pg.done)
+}
+
+// stopWorker waits for the worker to finish the changes sent and stops
+// it.
+func (pg *Playground) stopWorker() {
+	if pg.actions == nil {
+		return
+	}
+	for _, fn := range pg.queue {
+		pg.actions <- fn
+	}
+	pg.queue, pg.painted = nil, nil
+	close(pg.actions)
+	<-pg.done
+	pg.actions = nil
+}
+
+// work runs the changes and the ticks of the run until the actions are
+// closed, and publishes the frame after them.
+func (pg *Playground) work(actions <-chan func(), done chan<- struct{}) {
+	defer close(done)
+	var ticker *time.Ticker
+	var ticks <-chan time.Time
+	var interval time.Duration
+	defer func() {
+		if ticker != nil {
+			ticker.Stop()
+		}
+	}()
+	for {
+		select {
+		case fn, ok := <-actions:
+			if !ok {
+				return
+			}
+			fn()
+		case now := <-ticks:
+			pg.tick(now)
+		}
+		// the ticks follow the run and its rate
+		if d := pg.interval(); d != interval {
+			if ticker != nil {
+				ticker.Stop()
+				ticker, ticks = nil, nil
+			}
+			if d != 0 {
+				ticker = time.NewTicker(d)
+				ticks = ticker.C
+			}
+			interval = d
+		}
+		if len(actions) == 0 {
+			// the next changes are published at once
+			pg.publish()
+		}
+	}
+}
+
+// publish copies the universe into the frame not used by the GTK thread,
+// makes it the shown one and schedules the redraw.  The frames and
+// their universes are reused, so the run makes no garbage.
+func (pg *Playground) publish() {
+	pg.frameMu.Lock()
+	var f *frame
+	for i, ff := range pg.frames {
+		if ff == nil {
+			ff = new(frame)
+			pg.frames[i] = ff
+		}
+		if ff != pg.shown && ff != pg.front {
+			f = ff
+			break
+		}
+	}
+	pg.frameMu.Unlock()
+	var u convay.Universe
+	switch fu := f.u.(type) {
+	case *convay.Grid:
+		if pg.sparse == nil {
+			fu.CopyFrom(pg.grid)
+			u = fu
+		}
+	case *convay.Sparse:
+		if pg.sparse != nil {
+			fu.CopyFrom(pg.sparse)
+			u = fu
+		}
+	}
+	if u == nil {
+		if pg.sparse != nil {
+			u = pg.sparse.Clone()
+		} else {
+			u = pg.grid.Clone()
+		}
+	}
+	pg.fillFrame(f, u)
+	pg.frameMu.Lock()
+	pg.shown = f
+	redraw := pg.da != nil && !pg.pending
+	pg.pending = true
+	pg.frameMu.Unlock()
+	if redraw {
+		glib.IdleAdd(pg.redraw)
+	}
+}
+
+// redraw draws the latest frame, it runs in the GTK main loop.
+func (pg *Playground) redraw() bool {
+	pg.acquire()
+	pg.flush()
+	pg.da.QueueDraw()
+	return false
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"github.com/bukind/dots/convay"
+	"testing"
+	"time"
+)
+
+// waitFrame waits for the frame of the generation gen or a later one
+// like the redraw does.
+func waitFrame(t *testing.T, pg *Playground, gen uint64) *frame {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		pg.acquire()
+		if f := pg.current(); f.u.Iterations() >= gen {
+			return f
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("no frame of the generation %d", gen)
+	return nil
+}
+
+// shownGen returns the generation of the latest frame published.
+func shownGen(pg *Playground) uint64 {
+	pg.frameMu.Lock()
+	defer pg.frameMu.Unlock()
+	return pg.shown.u.Iterations()
+}
+
+func TestWorker(t *testing.T) {
+	pg := NewPlayground(7, 140, 140)
+	pg.Init(20, 20)
+	pg.grid.Clean()
+	pg.startWorker()
+	defer pg.stopWorker()
+
+	first := pg.current()
+	pg.Do(func() {
+		pg.SetMaxSpeed(true)
+		pg.BeginStroke(convay.Old)
+		pg.Paint(10, 10)
+		pg.Paint(11, 10)
+		pg.Paint(12, 10)
+		pg.Run(-1)
+	})
+	ExpectUint64(t, "first frame", first.u.Iterations(), 0)
+	ExpectUint64(t, "first frame cell", first.u.Get(10, 10), convay.Empty)
+	f := waitFrame(t, pg, 5)
+	if !f.running {
+		t.Error("the run is not shown")
+	}
+	gen, hash := f.u.Iterations(), f.u.Hash()
+	// the edits go between the steps
+	for x := 0; x < 5; x++ {
+		x := x
+		pg.Do(func() { pg.Paint(x, 0) })
+	}
+	// the frame used is not changed by the later ones
+	deadline := time.Now().Add(5 * time.Second)
+	for shownGen(pg) < gen+10 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	ExpectUint64(t, "frame", f.u.Iterations(), gen)
+	ExpectUint64(t, "frame hash", f.u.Hash(), hash)
+	// the frames are reused
+	g := waitFrame(t, pg, gen+10)
+	found := false
+	for _, ff := range pg.frames {
+		found = found || ff == g
+	}
+	if !found {
+		t.Error("the frame is not of the pool")
+	}
+
+	pg.Do(pg.Stop)
+	pg.Do(func() { pg.Paint(0, 19) })
+	pg.stopWorker()
+	ExpectUint64(t, "(0,19)", pg.grid.Get(0, 19), convay.Old)
+	f = pg.current()
+	if f.running {
+		t.Error("the run is shown after the stop")
+	}
+	ExpectUint64(t, "stopped", f.u.Iterations(), pg.grid.Iterations())
+}
+
+func TestWorkerQueue(t *testing.T) {
+	pg := NewPlayground(7, 140, 140)
+	pg.Init(200, 20)
+	pg.grid.Clean()
+	pg.startWorker()
+	defer pg.stopWorker()
+
+	block := make(chan bool)
+	pg.Do(func() { <-block })
+	queued := make(chan bool)
+	go func() {
+		// the busy worker does not block the changes
+		pg.Do(func() { pg.BeginStroke(convay.Old) })
+		for x := 0; x < 200; x++ {
+			pg.PaintLater(x, 5)
+		}
+		for i := 0; i < 100; i++ {
+			pg.Do(func() {})
+		}
+		queued <- true
+	}()
+	select {
+	case <-queued:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the changes are blocked")
+	}
+	// the paints beyond the room are one change
+	if len(pg.queue) > 101 {
+		t.Errorf("the paints are not merged: %d changes queued", len(pg.queue))
+	}
+	close(block)
+	pg.stopWorker()
+	young, old := pg.grid.Counts()
+	ExpectInt(t, "painted", young+old, 200)
+}